@@ -0,0 +1,257 @@
+package kero
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIPath is appended to [Kero.DashboardPath] to get the URL of the JSON API.
+const APIPath = "/api"
+
+// APIHandler returns a read-only JSON API to the tracked data. The handler expects requests
+// at the full path, ie. `DashboardPath + "/api/count"`, and doesn't do any authentication,
+// so it should be mounted behind the same auth as the dashboard.
+//
+// All endpoints accept the timeframe either as `start` and `end` Unix times in seconds
+// or the same params as the dashboard, see [ParseTimeframe], defaulting to today.
+// Histograms split days in the timezone of the `tz` param if set, see [WithTimezone].
+// Filters are passed as repeated `filter` params in form of `label=value` or `label!=value`.
+//
+//   - GET /api/query?metric=http_req: [Kero.Query]
+//   - GET /api/count?metric=http_req: [Kero.CountWithFilters]
+//   - GET /api/count_histogram?metric=http_req&interval=day: [Kero.CountHistogramWithInterval]
+//   - GET /api/visitors_histogram?metric=http_req&interval=day: [Kero.VisitorsHistogramWithInterval]
+//   - GET /api/aggregate?metric=http_req&group_by=$http_path&aggregate=count|sum|avg|min|max|stddev|p50|p75|p90|p95|p99: [Kero.AggregateDistinctByLabel]
+//   - GET /api/aggregate_histogram?metric=http_req_dur&aggregate=p95&interval=day: [Kero.AggregateHistogram]
+//   - GET /api/visitors_by_label?metric=http_req&label=$http_path: [Kero.CountDistinctByVisitorAndLabel]
+//   - GET /api/export?metric=http_req&format=csv|ndjson: [Kero.Export]
+func (k *Kero) APIHandler() http.Handler {
+	base := k.DashboardPath + APIPath
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET "+base+"/query", k.apiHandlerFunc(func(p apiParams) (any, error) {
+		metrics, err := k.Query(p.metric, p.filters, p.start, p.end)
+		if metrics == nil {
+			metrics = []Metric{}
+		}
+		return metrics, err
+	}))
+	mux.HandleFunc("GET "+base+"/count", k.apiHandlerFunc(func(p apiParams) (any, error) {
+		return map[string]int{"count": k.CountWithFilters(p.metric, p.filters, p.start, p.end)}, nil
+	}))
+	mux.HandleFunc("GET "+base+"/count_histogram", k.apiHandlerFunc(func(p apiParams) (any, error) {
+		return k.countHistogram(p.metric, p.filters, k.histogramSplits(p.interval, p.start, p.end, p.location)), nil
+	}))
+	mux.HandleFunc("GET "+base+"/visitors_histogram", k.apiHandlerFunc(func(p apiParams) (any, error) {
+		return k.visitorsHistogram(p.metric, p.filters, k.histogramSplits(p.interval, p.start, p.end, p.location)), nil
+	}))
+	mux.HandleFunc("GET "+base+"/aggregate", k.apiHandlerFunc(func(p apiParams) (any, error) {
+		groupBy, err := p.requiredParam("group_by")
+		if err != nil {
+			return nil, err
+		}
+		aggregateBy, err := parseAggregationMethod(p.query.Get("aggregate"))
+		if err != nil {
+			return nil, err
+		}
+
+		if groupBy == HttpRouteLabel {
+			return k.AggregateDistinct(p.metric, groupByRoute, p.filters, aggregateBy, p.start, p.end)
+		}
+		return k.AggregateDistinctByLabel(p.metric, groupBy, p.filters, aggregateBy, p.start, p.end)
+	}))
+	mux.HandleFunc("GET "+base+"/aggregate_histogram", k.apiHandlerFunc(func(p apiParams) (any, error) {
+		aggregateBy, err := parseAggregationMethod(p.query.Get("aggregate"))
+		if err != nil {
+			return nil, err
+		}
+		return k.aggregateHistogram(p.metric, p.filters, aggregateBy, k.histogramSplits(p.interval, p.start, p.end, p.location))
+	}))
+	mux.HandleFunc("GET "+base+"/visitors_by_label", k.apiHandlerFunc(func(p apiParams) (any, error) {
+		label, err := p.requiredParam("label")
+		if err != nil {
+			return nil, err
+		}
+		return k.CountDistinctByVisitorAndLabel(p.metric, label, p.filters, p.start, p.end)
+	}))
+	mux.HandleFunc("GET "+base+"/label_names", k.apiHandlerFunc(func(p apiParams) (any, error) {
+		return k.LabelNames(p.metric, p.filters, p.start, p.end)
+	}))
+	mux.HandleFunc("GET "+base+"/label_values", k.apiHandlerFunc(func(p apiParams) (any, error) {
+		label, err := p.requiredParam("label")
+		if err != nil {
+			return nil, err
+		}
+		return k.LabelValues(p.metric, label, p.filters, p.start, p.end)
+	}))
+
+	mux.HandleFunc("GET "+base+"/export", func(w http.ResponseWriter, r *http.Request) {
+		params, err := parseAPIParams(r.URL.Query(), k.location)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		format := ExportFormat(params.query.Get("format"))
+		if len(format) == 0 {
+			format = ExportCSV
+		}
+		if format != ExportCSV && format != ExportNDJSON {
+			writeAPIError(w, fmt.Errorf("%w: unknown format %q", errBadAPIRequest, format))
+			return
+		}
+
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, exportFileName(params.metric), format))
+		if err := k.Export(w, format, params.metric, params.filters, params.start, params.end); err != nil {
+			// response has already started so the error can't be reported to the client
+			fmt.Println("[kero] error exporting data", err)
+		}
+	})
+
+	return mux
+}
+
+// exportFileName turns the title into a name safe to use in the Content-Disposition header.
+func exportFileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, title)
+
+	return strings.Trim(name, "-")
+}
+
+// apiParams are the query params shared by all API endpoints.
+type apiParams struct {
+	query    url.Values
+	metric   string
+	filters  MetricLabels
+	start    int64
+	end      int64
+	interval time.Duration
+	location *time.Location
+}
+
+// errBadAPIRequest marks errors caused by invalid params.
+var errBadAPIRequest = errors.New("bad request")
+
+func (p apiParams) requiredParam(name string) (string, error) {
+	value := p.query.Get(name)
+	if len(value) == 0 {
+		return "", fmt.Errorf("%w: missing %s", errBadAPIRequest, name)
+	}
+
+	return value, nil
+}
+
+func (k *Kero) apiHandlerFunc(handler func(apiParams) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params, err := parseAPIParams(r.URL.Query(), k.location)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		data, err := handler(params)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, data)
+	}
+}
+
+func parseAPIParams(query url.Values, loc *time.Location) (apiParams, error) {
+	params := apiParams{query: query, filters: MetricLabels{}, location: loc}
+
+	params.metric = query.Get("metric")
+	if len(params.metric) == 0 {
+		return params, fmt.Errorf("%w: missing metric", errBadAPIRequest)
+	}
+
+	for _, filter := range query["filter"] {
+		label, value, ok := strings.Cut(filter, "=")
+		if !ok || len(label) == 0 || label == "!" {
+			return params, fmt.Errorf("%w: invalid filter %q", errBadAPIRequest, filter)
+		}
+		if strings.HasSuffix(label, "!") {
+			label += "="
+		}
+		params.filters[label] = value
+	}
+
+	if query.Has("start") || query.Has("end") {
+		var err error
+		if params.start, err = strconv.ParseInt(query.Get("start"), 10, 64); err != nil {
+			return params, fmt.Errorf("%w: invalid start", errBadAPIRequest)
+		}
+		if params.end, err = strconv.ParseInt(query.Get("end"), 10, 64); err != nil {
+			return params, fmt.Errorf("%w: invalid end", errBadAPIRequest)
+		}
+		if params.start > params.end {
+			return params, fmt.Errorf("%w: start is after end", errBadAPIRequest)
+		}
+		if tz := query.Get("tz"); len(tz) > 0 {
+			if params.location, err = time.LoadLocation(tz); err != nil {
+				return params, fmt.Errorf("%w: invalid tz: %w", errBadAPIRequest, err)
+			}
+		}
+		if params.interval, err = parseHistogramInterval(query.Get("interval")); err != nil {
+			return params, fmt.Errorf("%w: %w", errBadAPIRequest, err)
+		}
+		if err := validateHistogramInterval(params.interval, params.start, params.end); err != nil {
+			return params, fmt.Errorf("%w: %w", errBadAPIRequest, err)
+		}
+	} else {
+		tf, err := ParseTimeframe(query, loc)
+		if err != nil {
+			return params, fmt.Errorf("%w: %w", errBadAPIRequest, err)
+		}
+		params.start, params.end, params.interval, params.location = tf.Start, tf.End, tf.Interval, tf.Location
+	}
+
+	return params, nil
+}
+
+func parseAggregationMethod(method string) (AggregationMethod, error) {
+	if len(method) == 0 {
+		return AggregateCount, nil
+	}
+
+	aggregateBy, err := ParseAggregationMethod(method)
+	if err != nil {
+		return aggregateBy, fmt.Errorf("%w: %w", errBadAPIRequest, err)
+	}
+
+	return aggregateBy, nil
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, errBadAPIRequest) {
+		status = http.StatusBadRequest
+	}
+
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		fmt.Println("[kero] error encoding API response", err)
+	}
+}
@@ -0,0 +1,105 @@
+package kero
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIHandler(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()))
+	defer k.Close()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	trackPageViews(t, k, start, []testPageView{
+		{"a", "/", 0},
+		{"a", "/pricing", time.Minute},
+		{"b", "/", 2 * time.Minute},
+	})
+
+	h := k.APIHandler()
+	timeframe := "&start=" + strconv.FormatInt(start.Unix(), 10) + "&end=" + strconv.FormatInt(time.Now().Unix(), 10)
+	get := func(endpoint string, params string, result any) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", k.DashboardPath+APIPath+endpoint+"?"+params+timeframe, nil))
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(result); err != nil {
+				t.Fatal(endpoint, "returned invalid JSON", err)
+			}
+		}
+		return w.Code
+	}
+
+	var count map[string]int
+	get("/count", "metric=http_req&filter="+url.QueryEscape(HttpPathLabel+"!=/pricing"), &count)
+	if count["count"] != 2 {
+		t.Error("expected count of 2, got", count)
+	}
+
+	var metrics []Metric
+	get("/query", "metric=http_req&filter="+url.QueryEscape(HttpPathLabel+"=/pricing"), &metrics)
+	if len(metrics) != 1 || metrics[0].Labels[VisitorIdLabel] != "a" {
+		t.Error("expected one page view of /pricing, got", metrics)
+	}
+
+	var aggregated []AggregatedMetric
+	get("/aggregate", "metric=http_req&group_by="+url.QueryEscape(HttpPathLabel), &aggregated)
+	if len(aggregated) != 2 || aggregated[0].Label != "/" || aggregated[0].Value != 2 {
+		t.Error("unexpected aggregation", aggregated)
+	}
+
+	var visitors []AggregatedMetric
+	get("/visitors_by_label", "metric=http_req&label="+url.QueryEscape(HttpPathLabel), &visitors)
+	if len(visitors) != 2 || visitors[0].Value != 2 {
+		t.Error("unexpected visitors by label", visitors)
+	}
+
+	var values []string
+	get("/label_values", "metric=http_req&label="+url.QueryEscape(HttpPathLabel), &values)
+	if !slices.Equal(values, []string{"/", "/pricing"}) {
+		t.Error("unexpected label values", values)
+	}
+	get("/label_names", "metric=http_req", &values)
+	if !slices.Contains(values, VisitorIdLabel) {
+		t.Error("unexpected label names", values)
+	}
+
+	var histogram [][2]int64
+	get("/visitors_histogram", "metric=http_req", &histogram)
+	if len(histogram) == 0 {
+		t.Error("expected visitors histogram")
+	}
+	get("/count_histogram", "metric=http_req&interval=year", &histogram)
+	if len(histogram) == 0 || histogram[0][0] != start.Unix() {
+		t.Error("expected yearly histogram starting at start, got", histogram)
+	}
+	if code := get("/count_histogram", "metric=http_req&interval=fortnight", &histogram); code != http.StatusBadRequest {
+		t.Error("expected bad request with unknown interval, got", code)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", k.DashboardPath+APIPath+"/export?format=ndjson&metric=http_req"+timeframe, nil))
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), "\n") != 3 {
+		t.Error("expected 3 exported events, got", w.Code, w.Body.String())
+	}
+
+	badRequests := []struct{ endpoint, params string }{
+		{"/count", ""},
+		{"/count", "metric=http_req&filter=invalid"},
+		{"/aggregate", "metric=http_req"},
+		{"/aggregate", "metric=http_req&group_by=path&aggregate=median"},
+		{"/count", "metric=http_req&start=abc"},
+		{"/export", "metric=http_req&format=xml"},
+	}
+	for _, req := range badRequests {
+		if code := get(req.endpoint, req.params, nil); code != http.StatusBadRequest {
+			t.Error(req.endpoint, req.params, "expected status 400, got", code)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package kero
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+const visitorSketchesDirName = "visitors"
+const dailySketchFileName = "day.hll"
+
+// WithApproximateVisitors sets whether unique visitors should be estimated using HyperLogLog sketches
+// instead of being counted exactly. Estimates are usually within a few percent of the exact count, and exact
+// for small numbers of visitors, while using at most 16KB of memory per group regardless of the number of visitors.
+// Used by [Kero.CountVisitors], [Kero.VisitorsHistogram], [Kero.CountDistinctByVisitor] and [Kero.CountDistinctByVisitorAndLabel].
+//
+// With [WithRollups], sketches of each hour and day are stored with the rollups and merged when querying,
+// the same way as rolled-up counts are used.
+func WithApproximateVisitors(value bool) KeroOption {
+	return func(k *Kero) error {
+		k.approximateVisitors = value
+		return nil
+	}
+}
+
+// storedSketch is a sketch of visitors in a rolled-up period, stored in the file of the period.
+type storedSketch struct {
+	Metric    string
+	Dimension string
+	Value     string
+	Bot       bool
+	Sketch    []byte
+}
+
+// sketchPath returns the file with sketches of the hour or the UTC day starting at the timestamp.
+// Sketches are stored in a folder per day, ie. visitors/2024-01-31/13.hll and visitors/2024-01-31/day.hll.
+func (r *rollupStore) sketchPath(resolution string, periodStart int64) string {
+	t := time.UnixMilli(periodStart).UTC()
+	dir := filepath.Join(r.dir, visitorSketchesDirName, t.Format(time.DateOnly))
+	if resolution == rollupDaily {
+		return filepath.Join(dir, dailySketchFileName)
+	}
+
+	return filepath.Join(dir, t.Format("15")+".hll")
+}
+
+func (r *rollupStore) writeSketches(resolution string, periodStart int64, sketches map[rollupKey]*hyperLogLog) error {
+	if len(sketches) == 0 {
+		return nil
+	}
+
+	stored := make([]storedSketch, 0, len(sketches))
+	for key, sketch := range sketches {
+		data, err := sketch.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		stored = append(stored, storedSketch{key.metric, key.dimension, key.value, key.bot, data})
+	}
+
+	path := r.sketchPath(resolution, periodStart)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(stored); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// readSketches reads sketches of the period which are matched by the func. Periods without any visitors don't have a file.
+func (r *rollupStore) readSketches(resolution string, periodStart int64, match func(rollupKey) bool) (map[rollupKey]*hyperLogLog, error) {
+	f, err := os.Open(r.sketchPath(resolution, periodStart))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var stored []storedSketch
+	if err := gob.NewDecoder(f).Decode(&stored); err != nil {
+		return nil, err
+	}
+
+	sketches := make(map[rollupKey]*hyperLogLog)
+	for _, s := range stored {
+		key := rollupKey{s.Metric, s.Dimension, s.Value, s.Bot}
+		if !match(key) {
+			continue
+		}
+
+		sketch := &hyperLogLog{}
+		if err := sketch.UnmarshalBinary(s.Sketch); err != nil {
+			return nil, err
+		}
+		sketches[key] = sketch
+	}
+
+	return sketches, nil
+}
+
+// rollupDaySketches merges sketches of each hour of the UTC day starting at the timestamp.
+func (r *rollupStore) rollupDaySketches(day int64) error {
+	merged := make(map[rollupKey]*hyperLogLog)
+	for hour := day; hour < day+dayMillis; hour += hourMillis {
+		sketches, err := r.readSketches(rollupHourly, hour, func(rollupKey) bool { return true })
+		if err != nil {
+			return err
+		}
+
+		for key, sketch := range sketches {
+			if existing, exists := merged[key]; exists {
+				existing.Merge(sketch)
+			} else {
+				merged[key] = sketch
+			}
+		}
+	}
+
+	return r.writeSketches(rollupDaily, day, merged)
+}
+
+// removeExpiredSketches removes folders of days which ended before the rollup retention.
+func (r *rollupStore) removeExpiredSketches(now time.Time) error {
+	dir := filepath.Join(r.dir, visitorSketchesDirName)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		day, err := time.Parse(time.DateOnly, entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		if day.AddDate(0, 0, 1).Before(now.Add(-r.retention)) {
+			if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (rq rollupQuery) matches(key rollupKey) bool {
+	if key.metric != rq.metric || key.dimension != rq.dimension || (len(rq.value) > 0 && key.value != rq.value) {
+		return false
+	}
+
+	switch rq.bot {
+	case "0":
+		return !key.bot
+	case "1":
+		return key.bot
+	default:
+		return true
+	}
+}
+
+// visitorSketches builds sketches of visitors per time split and value of the label, or of all events if groupBy is empty.
+// Sketches are read from rollups where possible, otherwise they're built from raw events.
+func (k *Kero) visitorSketches(metric string, groupBy string, labelFilters MetricLabels, splits [][2]int64) ([]map[string]*hyperLogLog, error) {
+	sketches := make([]map[string]*hyperLogLog, len(splits))
+	for i := range sketches {
+		sketches[i] = make(map[string]*hyperLogLog)
+	}
+	sketchOf := func(split int, group string) *hyperLogLog {
+		sketch, exists := sketches[split][group]
+		if !exists {
+			sketch = newHyperLogLog()
+			sketches[split][group] = sketch
+		}
+		return sketch
+	}
+
+	rq, useRollups := k.rollupQueryFor(metric, groupBy, labelFilters)
+	watermark := int64(0)
+	if useRollups {
+		watermark = k.rollups.watermark.Load()
+	}
+
+	for _, segment := range splitRollupSegments(splits, watermark) {
+		if segment.resolution == rollupRaw {
+			if err := k.rawVisitorSketches(metric, groupBy, labelFilters, segment, splits, sketchOf); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		period := hourMillis
+		if segment.resolution == rollupDaily {
+			period = dayMillis
+		}
+		for start := segment.start; start < segment.end; start += period {
+			split := splitIndex(splits, start+period-1)
+			stored, err := k.rollups.readSketches(segment.resolution, start, rq.matches)
+			if err != nil {
+				return nil, err
+			}
+
+			for key, sketch := range stored {
+				group := ""
+				if len(groupBy) > 0 {
+					group = key.value
+				}
+				sketchOf(split, group).Merge(sketch)
+			}
+		}
+	}
+
+	return sketches, nil
+}
+
+func (k *Kero) rawVisitorSketches(
+	metric string,
+	groupBy string,
+	labelFilters MetricLabels,
+	segment rollupSegment,
+	splits [][2]int64,
+	sketchOf func(split int, group string) *hyperLogLog,
+) error {
+	q, err := k.db.Querier(segment.start, segment.end-1)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	ss := q.Select(context.Background(), false, nil, queryMatchers(metric, labelFilters)...)
+	var it chunkenc.Iterator
+	for ss.Next() {
+		series := ss.At()
+		lbls := series.Labels()
+
+		visitorId := lbls.Get(VisitorIdLabel)
+		group := ""
+		if len(groupBy) > 0 {
+			group = lbls.Get(groupBy)
+		}
+		if len(visitorId) == 0 || (len(groupBy) > 0 && len(group) == 0) {
+			continue
+		}
+
+		// visitor ID is the same for all samples of the series, so it's added only once per split
+		visitorHash := hllHash(visitorId)
+		lastSplit := -1
+		it = series.Iterator(it)
+		for it.Next() == chunkenc.ValFloat {
+			if split := splitIndex(splits, it.AtT()); split >= 0 && split != lastSplit {
+				sketchOf(split, group).AddHash(visitorHash)
+				lastSplit = split
+			}
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+	}
+
+	return ss.Err()
+}
+
+// estimatedVisitors turns sketches of each group into results sorted by highest estimate first.
+func estimatedVisitors(sketches map[string]*hyperLogLog) []AggregatedMetric {
+	allMetrics := []AggregatedMetric{}
+	for group, sketch := range sketches {
+		allMetrics = append(allMetrics, AggregatedMetric{
+			Label: group,
+			Value: float64(sketch.Estimate()),
+		})
+	}
+
+	sort.SliceStable(allMetrics, func(i, j int) bool { return allMetrics[i].Value > allMetrics[j].Value })
+
+	return allMetrics
+}
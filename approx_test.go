@@ -0,0 +1,99 @@
+package kero
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApproximateVisitors(t *testing.T) {
+	dbPath := t.TempDir()
+	k, _ := New(WithDB(dbPath))
+
+	base := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -3)
+	trackPageViews(t, k, base, []testPageView{
+		{"a", "/", 70 * time.Minute},
+		{"b", "/", 80 * time.Minute},
+		{"a", "/pricing", 5 * time.Hour},
+		{"a", "/", 26 * time.Hour},
+		{"c", "/pricing", 27 * time.Hour},
+		{"d", "/", 49 * time.Hour},
+	})
+	k.trackAt(HttpReqMetricName, MetricLabels{VisitorIdLabel: "bot", HttpPathLabel: "/", BrowserFormFactorLabel: FormFactorBot}, 1, base.Add(50*time.Hour))
+	k.trackAt(HttpReqMetricName, MetricLabels{VisitorIdLabel: "e", HttpPathLabel: "/"}, 1, time.Now().Add(-time.Minute))
+	k.Close()
+
+	k, err := New(WithDB(dbPath), WithRollups(365*24*time.Hour), WithApproximateVisitors(true))
+	if err != nil {
+		t.Fatal("failed to open kero", err)
+	}
+	defer k.Close()
+	if err := k.rollupPending(time.Now()); err != nil {
+		t.Fatal("failed to write rollups", err)
+	}
+	if _, err := os.Stat(filepath.Join(dbPath, rollupsDirName, visitorSketchesDirName, base.Format(time.DateOnly), dailySketchFileName)); err != nil {
+		t.Fatal("expected sketches of the day to be stored", err)
+	}
+
+	// raw data is deleted to make sure sketches are read from rollups
+	watermark := k.rollups.watermark.Load()
+	if err := k.db.Delete(context.Background(), math.MinInt64, watermark-1, queryMatchers("", nil)...); err != nil {
+		t.Fatal("failed to delete raw data", err)
+	}
+
+	start, end := base.Add(-time.Hour).Unix(), time.Now().Unix()
+	if count, err := k.CountVisitors(HttpReqMetricName, botFilter, start, end); err != nil || count != 5 {
+		t.Error("expected 5 visitors, got", count, err)
+	}
+	if count, _ := k.CountVisitors(HttpReqMetricName, nil, start, end); count != 6 {
+		t.Error("expected 6 visitors including bots, got", count)
+	}
+
+	paths, err := k.CountDistinctByVisitorAndLabel(HttpReqMetricName, HttpPathLabel, botFilter, start, end)
+	if err != nil || len(paths) != 2 || paths[0].Label != "/" || paths[0].Value != 4 || paths[1].Value != 2 {
+		t.Error("unexpected visitors by path", paths, err)
+	}
+
+	histogram := k.VisitorsHistogram(HttpReqMetricName, botFilter, base.Unix(), base.AddDate(0, 0, 4).Unix())
+	want := []int64{2, 2, 1, 1}
+	for i, split := range histogram {
+		if split[1] != want[i] {
+			t.Error("split", i, "expected", want[i], "got", split[1])
+		}
+	}
+
+	// grouping by a func can only use raw data
+	routes, err := k.CountDistinctByVisitor(HttpReqMetricName, groupByLabel(HttpPathLabel), nil, start, end)
+	if err != nil || len(routes) != 1 || routes[0].Value != 1 {
+		t.Error("expected only the latest visitor in raw data, got", routes, err)
+	}
+}
+
+func TestRemoveExpiredSketches(t *testing.T) {
+	r := &rollupStore{dir: t.TempDir(), retention: 48 * time.Hour}
+	now := time.Now().UTC()
+	old := now.AddDate(0, 0, -5).Truncate(24 * time.Hour).UnixMilli()
+	recent := now.AddDate(0, 0, -1).Truncate(24 * time.Hour).UnixMilli()
+
+	sketch := newHyperLogLog()
+	sketch.Add("a")
+	for _, day := range []int64{old, recent} {
+		if err := r.writeSketches(rollupDaily, day, map[rollupKey]*hyperLogLog{{metric: HttpReqMetricName}: sketch}); err != nil {
+			t.Fatal("failed to write sketches", err)
+		}
+	}
+
+	if err := r.removeExpiredSketches(now); err != nil {
+		t.Fatal("failed to remove sketches", err)
+	}
+	if _, err := os.Stat(r.sketchPath(rollupDaily, old)); !os.IsNotExist(err) {
+		t.Error("expected old sketches to be removed")
+	}
+	all := func(rollupKey) bool { return true }
+	if sketches, err := r.readSketches(rollupDaily, recent, all); err != nil || len(sketches) != 1 {
+		t.Error("expected recent sketches to be kept", sketches, err)
+	}
+}
@@ -1,17 +1,3 @@
-const SELECTED_TIMEFRAME = (new URLSearchParams(window.location.search)).get('t') || 't';
-
-function updateTimeframeSelector() {
-    const options = document.querySelectorAll('#timeframe-selector a');
-    for (let option of options) {
-        const href = option.getAttribute('href');
-        if (href === `?t=${SELECTED_TIMEFRAME}`) {
-            option.classList.add('active');
-            document.getElementById('selected-timeframe-label').innerHTML = option.innerHTML;
-            return;
-        }
-    }
-}
-
 function showAllTableItemsInModal(e) {
     e.preventDefault();
 
@@ -60,6 +46,5 @@ function localizeNumbers() {
 
 window.addEventListener('DOMContentLoaded', () => {
     initShowAllInModal();
-    updateTimeframeSelector();
     localizeNumbers();
 }, false);
@@ -0,0 +1,174 @@
+// Kero beacon script, served at the beacon path set with WithBeaconPath.
+// Tracks page views of client-side navigations and exposes kero.track(name, props) for custom events:
+//
+//   <script src="/_kero/beacon/script.js" defer></script>
+//   <button onclick="kero.track('signup', {plan: 'pro'})">Sign up</button>
+//
+// Page view of the initial page load is tracked only with the data-initial-pageview attribute,
+// as it's usually tracked by the server already.
+//
+// Web vitals (LCP, INP, CLS, FCP and TTFB) of the initial page load are measured as well and sent once each,
+// at the latest when the page is hidden. See https://web.dev/articles/vitals for their definitions.
+(function () {
+    'use strict';
+
+    const script = document.currentScript;
+    const endpoint = script.src.replace(/\/script\.js(\?.*)?$/, '');
+
+    let lastUrl = location.href;
+    let lastPath = location.pathname;
+    let referrer = document.referrer;
+
+    function post(event) {
+        const payload = JSON.stringify(event);
+
+        // sent as text, so that cross-origin requests don't need a CORS preflight
+        if (navigator.sendBeacon && navigator.sendBeacon(endpoint, payload)) {
+            return;
+        }
+        fetch(endpoint, { method: 'POST', body: payload, keepalive: true, credentials: 'omit' }).catch(() => {});
+    }
+
+    function send(name, props) {
+        post({
+            name: name,
+            url: location.href,
+            referrer: referrer,
+            props: props || {},
+        });
+    }
+
+    function trackNavigation() {
+        // changes of the query or hash only aren't new page views
+        if (location.pathname === lastPath) {
+            lastUrl = location.href;
+            return;
+        }
+
+        referrer = lastUrl;
+        lastUrl = location.href;
+        lastPath = location.pathname;
+        send('pageview');
+    }
+
+    function hookHistory(method) {
+        const original = history[method];
+        history[method] = function () {
+            const result = original.apply(this, arguments);
+            trackNavigation();
+            return result;
+        };
+    }
+
+    hookHistory('pushState');
+    hookHistory('replaceState');
+    window.addEventListener('popstate', trackNavigation);
+
+    window.kero = window.kero || {};
+    window.kero.track = function (name, props) {
+        const stringProps = {};
+        for (const key in props || {}) {
+            stringProps[key] = String(props[key]);
+        }
+        send(name, stringProps);
+    };
+
+    if (script.hasAttribute('data-initial-pageview')) {
+        send('pageview');
+    }
+
+    // vitals are reported for the page which was loaded, even after client-side navigations
+    const pageUrl = location.href;
+    const vitals = {};
+    const reportedVitals = {};
+
+    function reportVital(name, value) {
+        if (reportedVitals[name] || value === undefined) {
+            return;
+        }
+
+        reportedVitals[name] = true;
+        post({ name: 'web_vital_' + name, url: pageUrl, value: value });
+    }
+
+    function observe(type, callback, options) {
+        if (!window.PerformanceObserver || !(PerformanceObserver.supportedEntryTypes || []).includes(type)) {
+            return false;
+        }
+
+        try {
+            new PerformanceObserver((list) => list.getEntries().forEach(callback))
+                .observe(Object.assign({ type: type, buffered: true }, options));
+            return true;
+        } catch (e) {
+            return false;
+        }
+    }
+
+    const navigation = performance.getEntriesByType ? performance.getEntriesByType('navigation')[0] : null;
+    // prerendered pages are measured from the moment they're shown
+    const activationStart = (navigation && navigation.activationStart) || 0;
+
+    if (navigation && navigation.responseStart > 0) {
+        reportVital('ttfb', Math.max(navigation.responseStart - activationStart, 0));
+    }
+
+    observe('paint', (entry) => {
+        if (entry.name === 'first-contentful-paint') {
+            reportVital('fcp', Math.max(entry.startTime - activationStart, 0));
+        }
+    });
+
+    observe('largest-contentful-paint', (entry) => {
+        vitals.lcp = Math.max(entry.startTime - activationStart, 0);
+    });
+
+    // layout shifts are grouped into windows of up to 5s with gaps of less than 1s, CLS is the largest window
+    let shiftWindow = 0;
+    let shiftWindowStart = 0;
+    let lastShift = 0;
+    const clsObserved = observe('layout-shift', (entry) => {
+        if (entry.hadRecentInput) {
+            return;
+        }
+
+        if (shiftWindow > 0 && entry.startTime - lastShift < 1000 && entry.startTime - shiftWindowStart < 5000) {
+            shiftWindow += entry.value;
+        } else {
+            shiftWindow = entry.value;
+            shiftWindowStart = entry.startTime;
+        }
+        lastShift = entry.startTime;
+        vitals.cls = Math.max(vitals.cls || 0, shiftWindow);
+    });
+    if (clsObserved) {
+        vitals.cls = vitals.cls || 0;
+    }
+
+    // INP is the longest interaction, ignoring one in every 50 interactions as outliers
+    const interactions = {};
+    function trackInteraction(entry) {
+        if (!entry.interactionId) {
+            return;
+        }
+
+        interactions[entry.interactionId] = Math.max(interactions[entry.interactionId] || 0, entry.duration);
+        const durations = Object.values(interactions).sort((a, b) => b - a);
+        vitals.inp = durations[Math.min(durations.length - 1, Math.floor(durations.length / 50))];
+    }
+    observe('event', trackInteraction, { durationThreshold: 40 });
+    observe('first-input', trackInteraction);
+
+    // LCP, CLS and INP can change until the page is hidden, which may be the last chance to send them
+    function reportFinalVitals() {
+        reportVital('lcp', vitals.lcp);
+        reportVital('cls', vitals.cls);
+        reportVital('inp', vitals.inp);
+    }
+    document.addEventListener('visibilitychange', () => {
+        if (document.visibilityState === 'hidden') {
+            reportFinalVitals();
+        }
+    });
+    window.addEventListener('pagehide', reportFinalVitals);
+})();
@@ -0,0 +1,77 @@
+// Kero links script, served at the beacon path set with WithBeaconPath.
+// Tracks clicks on links to other sites as outbound_click events and clicks on links to files as file_download events:
+//
+//   <script src="/_kero/beacon/links.js" defer></script>
+//
+// Links are treated as downloads if they have the download attribute or one of the extensions below,
+// which can be replaced with the data-extensions attribute, ie. data-extensions="pdf,zip".
+(function () {
+    'use strict';
+
+    const script = document.currentScript;
+    const endpoint = script.src.replace(/\/links\.js(\?.*)?$/, '');
+
+    const defaultExtensions = [
+        '7z', 'apk', 'avi', 'bz2', 'csv', 'dmg', 'doc', 'docx', 'epub', 'exe', 'gz', 'iso', 'key', 'mov', 'mp3', 'mp4',
+        'msi', 'numbers', 'odp', 'ods', 'odt', 'pages', 'pdf', 'pkg', 'ppt', 'pptx', 'rar', 'rtf', 'tar', 'tgz', 'txt',
+        'wav', 'xls', 'xlsx', 'xz', 'zip',
+    ];
+    const extensions = script.hasAttribute('data-extensions')
+        ? script.getAttribute('data-extensions').split(',').map((ext) => ext.trim().toLowerCase())
+        : defaultExtensions;
+
+    function send(name, linkUrl) {
+        const payload = JSON.stringify({
+            name: name,
+            url: location.href,
+            referrer: document.referrer,
+            props: { url: linkUrl },
+        });
+
+        // sent as text, so that cross-origin requests don't need a CORS preflight
+        if (navigator.sendBeacon && navigator.sendBeacon(endpoint, payload)) {
+            return;
+        }
+        fetch(endpoint, { method: 'POST', body: payload, keepalive: true, credentials: 'omit' }).catch(() => {});
+    }
+
+    function isDownload(link, url) {
+        if (link.hasAttribute('download')) {
+            return true;
+        }
+
+        const dot = url.pathname.lastIndexOf('.');
+        return dot > url.pathname.lastIndexOf('/') && extensions.includes(url.pathname.slice(dot + 1).toLowerCase());
+    }
+
+    function trackClick(event) {
+        // only primary and middle clicks open links
+        if (event.type === 'auxclick' && event.button !== 1) {
+            return;
+        }
+
+        const link = event.target.closest && event.target.closest('a[href]');
+        if (!link) {
+            return;
+        }
+
+        let url;
+        try {
+            url = new URL(link.href, location.href);
+        } catch (e) {
+            return;
+        }
+        if (url.protocol !== 'http:' && url.protocol !== 'https:') {
+            return;
+        }
+
+        if (isDownload(link, url)) {
+            send('file_download', url.href);
+        } else if (url.host !== location.host) {
+            send('outbound_click', url.href);
+        }
+    }
+
+    document.addEventListener('click', trackClick, { capture: true });
+    document.addEventListener('auxclick', trackClick, { capture: true });
+})();
@@ -0,0 +1,241 @@
+package kero
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// BeaconScriptPath is appended to [Kero.BeaconPath] to get the URL of the beacon script.
+const BeaconScriptPath = "/script.js"
+
+// BeaconLinksScriptPath is appended to [Kero.BeaconPath] to get the URL of the opt-in script tracking
+// clicks on outbound links and file downloads, see [WithBeaconPath].
+const BeaconLinksScriptPath = "/links.js"
+
+// PageViewEvent is the name of beacon events tracked as page views, ie. as `http_req` metrics.
+const PageViewEvent = "pageview"
+
+const maxBeaconSize = 16 * 1024
+const maxBeaconProps = 20
+
+// limits of custom events, as each distinct name and value creates a new series in the database
+const maxBeaconNameLength = 64
+const maxBeaconValueLength = 256
+
+// ErrInvalidBeacon is returned by [Kero.TrackBeacon] for events which can't be tracked.
+var ErrInvalidBeacon = errors.New("invalid beacon event")
+
+// BeaconEvent is an event sent from the browser by the beacon script, see [WithBeaconPath].
+type BeaconEvent struct {
+	Name     string            `json:"name"`     // PageViewEvent or name of a custom event. Page view if empty.
+	URL      string            `json:"url"`      // URL of the page on which the event happened
+	Referrer string            `json:"referrer"` // URL of the previous page
+	Props    map[string]string `json:"props"`    // Labels of custom events
+	Value    float64           `json:"value"`    // Measured value of web vitals
+}
+
+// WithBeaconPath defines the route at which events sent from the browser are received and at which the beacon script
+// is served (with [BeaconScriptPath] appended), ie. `/_kero/beacon/script.js` for `/_kero/beacon`.
+// The script tracks page views of client-side navigations using the History API and
+// exposes `kero.track(name, props)` for tracking custom events:
+//
+//	<script src="/_kero/beacon/script.js" defer></script>
+//
+// Page views of the initial page load are tracked by the server, as with any other request, unless
+// the script tag has the `data-initial-pageview` attribute. The script also measures [WebVitals] of the loaded page.
+//
+// Clicks on links to other sites and downloads of files are tracked as `outbound_click` and `file_download` metrics
+// by the links script, served with [BeaconLinksScriptPath] appended:
+//
+//	<script src="/_kero/beacon/links.js" defer></script>
+func WithBeaconPath(path string) KeroOption {
+	return func(k *Kero) error {
+		if !isValidPathArg(path) {
+			return errors.New("BeaconPath must start with / and have at least one more character")
+		}
+		k.BeaconPath = strings.TrimSuffix(path, "/")
+		return nil
+	}
+}
+
+// WithBeaconEvents limits custom events accepted by the beacon endpoint to the listed names, see [WithBeaconPath].
+// Page views, web vitals, outbound clicks and file downloads are always accepted. All custom events are accepted by default.
+func WithBeaconEvents(names ...string) KeroOption {
+	return func(k *Kero) error {
+		events := make(map[string]bool, len(names))
+		for _, name := range names {
+			if err := validateBeaconEventName(name); err != nil {
+				return err
+			}
+			events[name] = true
+		}
+		k.beaconEvents = events
+		return nil
+	}
+}
+
+// TrackBeacon tracks the event sent by the beacon script. Page views are tracked the same way as requests to the server,
+// using the path and query of the event's URL, while custom events are tracked as metrics with the event's name
+// and its props as labels. [OutboundClickMetricName] and [FileDownloadMetricName] events are tracked with the link's URL
+// and domain, from the `url` prop, and web vitals with [Kero.TrackWebVital]. Request headers are used for visitor, browser and location labels, so DNT and bot filtering
+// apply as well. Events on paths ignored by [Kero.ShouldTrackHttpRequest] are not tracked.
+// Custom events not listed with [WithBeaconEvents], and the ones with too long names or props, are rejected.
+func (k *Kero) TrackBeacon(event BeaconEvent, req TrackedHttpReq) error {
+	pageUrl, err := url.Parse(event.URL)
+	if err != nil || len(pageUrl.Path) == 0 {
+		return fmt.Errorf("%w: invalid url %q", ErrInvalidBeacon, event.URL)
+	}
+	if !k.ShouldTrackHttpRequest(pageUrl.Path) {
+		return nil
+	}
+
+	req.Path = pageUrl.Path
+	req.Query = pageUrl.Query()
+	req.Route = ""
+	req.StatusCode = 0
+	req.Headers = req.Headers.Clone()
+	req.Headers.Del("Referer")
+	if len(event.Referrer) > 0 {
+		req.Headers.Set("Referer", event.Referrer)
+	}
+
+	if len(event.Name) == 0 || event.Name == PageViewEvent {
+		req.Method = http.MethodGet
+		return k.TrackHttpRequest(req)
+	}
+
+	if strings.HasPrefix(event.Name, WebVitalMetricPrefix) {
+		err := k.TrackWebVital(event.Name, event.Value, req)
+		if errors.Is(err, ErrInvalidWebVital) {
+			return fmt.Errorf("%w: %w", ErrInvalidBeacon, err)
+		}
+		return err
+	}
+
+	var labels MetricLabels
+	if event.Name == OutboundClickMetricName || event.Name == FileDownloadMetricName {
+		labels, err = linkEventLabels(event)
+	} else if k.beaconEvents != nil && !k.beaconEvents[event.Name] {
+		err = fmt.Errorf("%w: unknown event %q", ErrInvalidBeacon, event.Name)
+	} else {
+		labels, err = beaconEventLabels(event)
+	}
+	if err != nil {
+		return err
+	}
+
+	return k.TrackOneWithRequest(event.Name, labels, req)
+}
+
+// validateBeaconEventName rejects names of metrics reserved for Kero (http_req*) and names which are too long.
+func validateBeaconEventName(name string) error {
+	if strings.HasPrefix(name, HttpReqMetricName) || strings.HasPrefix(name, "$") || strings.HasPrefix(name, "__") {
+		return fmt.Errorf("%w: reserved event name %q", ErrInvalidBeacon, name)
+	}
+	if len(name) > maxBeaconNameLength {
+		return fmt.Errorf("%w: event name longer than %d bytes", ErrInvalidBeacon, maxBeaconNameLength)
+	}
+
+	return nil
+}
+
+// beaconEventLabels validates the custom event, as labels starting with $ and http_req* metrics are reserved for Kero.
+func beaconEventLabels(event BeaconEvent) (MetricLabels, error) {
+	if err := validateBeaconEventName(event.Name); err != nil {
+		return nil, err
+	}
+	if len(event.Props) > maxBeaconProps {
+		return nil, fmt.Errorf("%w: more than %d props", ErrInvalidBeacon, maxBeaconProps)
+	}
+
+	labels := make(MetricLabels, len(event.Props))
+	for name, value := range event.Props {
+		if len(name) == 0 || strings.HasPrefix(name, "$") || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("%w: reserved prop name %q", ErrInvalidBeacon, name)
+		}
+		if len(name) > maxBeaconNameLength {
+			return nil, fmt.Errorf("%w: prop name longer than %d bytes", ErrInvalidBeacon, maxBeaconNameLength)
+		}
+		if len(value) > maxBeaconValueLength {
+			return nil, fmt.Errorf("%w: value of prop %q longer than %d bytes", ErrInvalidBeacon, name, maxBeaconValueLength)
+		}
+		labels[name] = value
+	}
+
+	return labels, nil
+}
+
+// linkEventLabels returns labels of the clicked link. Only absolute http(s) URLs are accepted and their query and fragment
+// are dropped, as they often contain tokens and would make too many distinct values.
+func linkEventLabels(event BeaconEvent) (MetricLabels, error) {
+	linkUrl, err := url.Parse(event.Props["url"])
+	if err != nil || (linkUrl.Scheme != "http" && linkUrl.Scheme != "https") || len(linkUrl.Hostname()) == 0 {
+		return nil, fmt.Errorf("%w: invalid link url %q", ErrInvalidBeacon, event.Props["url"])
+	}
+
+	linkUrl.User = nil
+	linkUrl.RawQuery = ""
+	linkUrl.ForceQuery = false
+	linkUrl.Fragment = ""
+	if len(linkUrl.String()) > maxBeaconValueLength {
+		return nil, fmt.Errorf("%w: link url longer than %d bytes", ErrInvalidBeacon, maxBeaconValueLength)
+	}
+
+	return MetricLabels{
+		LinkUrlLabel:    linkUrl.String(),
+		LinkDomainLabel: linkUrl.Hostname(),
+	}, nil
+}
+
+// BeaconHandler returns the handler receiving events at [Kero.BeaconPath] and serving the beacon and links scripts,
+// see [WithBeaconPath]. Events are accepted as JSON encoded [BeaconEvent] regardless of the content type,
+// as the script sends them as text to avoid CORS preflight requests.
+func (k *Kero) BeaconHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST "+k.BeaconPath, func(w http.ResponseWriter, r *http.Request) {
+		var event BeaconEvent
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBeaconSize)).Decode(&event); err != nil {
+			http.Error(w, "invalid event", http.StatusBadRequest)
+			return
+		}
+
+		if err := k.TrackBeacon(event, TrackedRequestFromHttp(r)); err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, ErrInvalidBeacon):
+				status = http.StatusBadRequest
+			case errors.Is(err, ErrIngestQueueFull):
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.Handle("GET "+k.BeaconPath+BeaconScriptPath, scriptHandler("assets/js/kero.js"))
+	mux.Handle("GET "+k.BeaconPath+BeaconLinksScriptPath, scriptHandler("assets/js/links.js"))
+
+	return mux
+}
+
+func scriptHandler(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		script, err := fs.ReadFile(DashboardWebAssets, name)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/javascript;charset=utf-8")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(script)
+	}
+}
@@ -0,0 +1,107 @@
+package kero
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrackBeacon(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()), WithBeaconPath("/_k/"), WithBotsIgnored(true))
+	defer k.Close()
+
+	browser := TrackedHttpReq{
+		Method: http.MethodPost,
+		Path:   k.BeaconPath,
+		Headers: http.Header{
+			"User-Agent": {"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"},
+			"Referer":    {"https://example.com/"},
+		},
+		RemoteAddr: "127.0.0.1:1234",
+	}
+	bot := TrackedHttpReq{Method: http.MethodPost, Headers: http.Header{"User-Agent": {"curl/8.0"}}}
+	dnt := browser
+	dnt.Headers = browser.Headers.Clone()
+	dnt.Headers.Set("DNT", "1")
+
+	tests := []struct {
+		event BeaconEvent
+		req   TrackedHttpReq
+		err   error
+	}{
+		{BeaconEvent{URL: "https://example.com/pricing", Referrer: "https://example.com/"}, browser, nil},
+		{BeaconEvent{Name: "signup", URL: "https://example.com/pricing", Props: map[string]string{"plan": "pro"}}, browser, nil},
+		{BeaconEvent{Name: OutboundClickMetricName, URL: "https://example.com/", Props: map[string]string{"url": "https://user@github.com/josip?tab=repos#top"}}, browser, nil},
+		{BeaconEvent{Name: FileDownloadMetricName, URL: "https://example.com/", Props: map[string]string{"url": "https://example.com/files/report.pdf"}}, browser, nil},
+		// not tracked
+		{BeaconEvent{URL: "https://example.com/docs"}, bot, nil},
+		{BeaconEvent{URL: "https://example.com/docs"}, dnt, nil},
+		{BeaconEvent{URL: "https://example.com/_k"}, browser, nil},
+		// invalid
+		{BeaconEvent{URL: "::"}, browser, ErrInvalidBeacon},
+		{BeaconEvent{Name: "http_req_dur", URL: "https://example.com/"}, browser, ErrInvalidBeacon},
+		{BeaconEvent{Name: "signup", URL: "https://example.com/", Props: map[string]string{VisitorIdLabel: "a"}}, browser, ErrInvalidBeacon},
+		{BeaconEvent{Name: OutboundClickMetricName, URL: "https://example.com/", Props: map[string]string{"url": "mailto:hi@example.com"}}, browser, ErrInvalidBeacon},
+		{BeaconEvent{Name: FileDownloadMetricName, URL: "https://example.com/", Props: map[string]string{"url": "/files/report.pdf"}}, browser, ErrInvalidBeacon},
+		{BeaconEvent{Name: strings.Repeat("a", maxBeaconNameLength+1), URL: "https://example.com/"}, browser, ErrInvalidBeacon},
+		{BeaconEvent{Name: "signup", URL: "https://example.com/", Props: map[string]string{strings.Repeat("a", maxBeaconNameLength+1): "a"}}, browser, ErrInvalidBeacon},
+		{BeaconEvent{Name: "signup", URL: "https://example.com/", Props: map[string]string{"plan": strings.Repeat("a", maxBeaconValueLength+1)}}, browser, ErrInvalidBeacon},
+		{BeaconEvent{Name: OutboundClickMetricName, URL: "https://example.com/", Props: map[string]string{"url": "https://github.com/" + strings.Repeat("a", maxBeaconValueLength)}}, browser, ErrInvalidBeacon},
+	}
+	for _, test := range tests {
+		if err := k.TrackBeacon(test.event, test.req); !errors.Is(err, test.err) {
+			t.Error(test.event, "expected error", test.err, "got", err)
+		}
+	}
+	k.Flush()
+
+	now := time.Now().Unix()
+	pageViews, _ := k.Query(HttpReqMetricName, nil, 0, now)
+	if len(pageViews) != 1 || pageViews[0].Labels[HttpPathLabel] != "/pricing" || pageViews[0].Labels[HttpMethodLabel] != http.MethodGet {
+		t.Error("expected a page view of /pricing, got", pageViews)
+	}
+	if referrer := pageViews[0].Labels[ReferrerLabel]; referrer != "https://example.com/" {
+		t.Error("expected referrer of the page, got", referrer)
+	}
+	if events, _ := k.Query("signup", MetricLabels{"plan": "pro"}, 0, now); len(events) != 1 {
+		t.Error("expected custom event to be tracked, got", events)
+	}
+	if clicks, _ := k.Query(OutboundClickMetricName, MetricLabels{LinkDomainLabel: "github.com"}, 0, now); len(clicks) != 1 || clicks[0].Labels[LinkUrlLabel] != "https://github.com/josip" {
+		t.Error("expected outbound click without credentials, query and fragment, got", clicks)
+	}
+	if downloads, _ := k.Query(FileDownloadMetricName, MetricLabels{LinkUrlLabel: "https://example.com/files/report.pdf"}, 0, now); len(downloads) != 1 {
+		t.Error("expected file download to be tracked, got", downloads)
+	}
+
+	if _, err := New(WithDB(t.TempDir()), WithBeaconPath("beacon")); err == nil {
+		t.Error("should fail with invalid beacon path")
+	}
+}
+
+func TestBeaconEvents(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()), WithBeaconPath("/_k"), WithBeaconEvents("signup"))
+	defer k.Close()
+
+	req := TrackedHttpReq{Method: http.MethodPost, Headers: http.Header{"User-Agent": {"Mozilla/5.0"}}, RemoteAddr: "127.0.0.1:1234"}
+	tests := []struct {
+		event BeaconEvent
+		err   error
+	}{
+		{BeaconEvent{Name: "signup", URL: "https://example.com/"}, nil},
+		{BeaconEvent{Name: PageViewEvent, URL: "https://example.com/"}, nil},
+		{BeaconEvent{Name: OutboundClickMetricName, URL: "https://example.com/", Props: map[string]string{"url": "https://github.com/"}}, nil},
+		{BeaconEvent{Name: "web_vital_lcp", URL: "https://example.com/", Value: 1200}, nil},
+		{BeaconEvent{Name: "purchase", URL: "https://example.com/"}, ErrInvalidBeacon},
+	}
+	for _, test := range tests {
+		if err := k.TrackBeacon(test.event, req); !errors.Is(err, test.err) {
+			t.Error(test.event, "expected error", test.err, "got", err)
+		}
+	}
+
+	if _, err := New(WithDB(t.TempDir()), WithBeaconEvents("http_req")); err == nil {
+		t.Error("should fail with reserved event name")
+	}
+}
@@ -0,0 +1,124 @@
+package kero
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIpSource selects which forwarding headers set by trusted proxies contain the IP address of the client.
+type ClientIpSource int
+
+const (
+	ClientIpFromForwardedFor ClientIpSource = iota // X-Forwarded-For, or X-Real-IP if it's not set
+	ClientIpFromCloudflare                         // CF-Connecting-IP
+	ClientIpFromRemoteAddr                         // Forwarding headers are ignored
+)
+
+// WithTrustedProxies sets the IP ranges of reverse proxies and load balancers in front of the server.
+// Forwarding headers (see [WithClientIpSource]) are used only for requests coming from these ranges,
+// otherwise the client IP is the remote address of the connection. By default no proxies are trusted.
+func WithTrustedProxies(proxies []netip.Prefix) KeroOption {
+	return func(k *Kero) error {
+		for _, proxy := range proxies {
+			if !proxy.IsValid() {
+				return errors.New("invalid trusted proxy range")
+			}
+		}
+
+		k.trustedProxies = proxies
+		return nil
+	}
+}
+
+// WithClientIpSource sets which headers set by trusted proxies contain the client IP. Defaults to X-Forwarded-For.
+func WithClientIpSource(source ClientIpSource) KeroOption {
+	return func(k *Kero) error {
+		if source < ClientIpFromForwardedFor || source > ClientIpFromRemoteAddr {
+			return errors.New("unknown client IP source")
+		}
+
+		k.clientIpSource = source
+		return nil
+	}
+}
+
+func (k *Kero) isTrustedProxy(addr netip.Addr) bool {
+	for _, proxy := range k.trustedProxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIp resolves the IP address of the client, reading forwarding headers only if the request came from a trusted proxy.
+func (k *Kero) clientIp(headers http.Header, remoteAddr string) string {
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+
+	remote, err := netip.ParseAddr(host)
+	if err != nil {
+		return ""
+	}
+	remote = remote.Unmap()
+
+	if !k.isTrustedProxy(remote) {
+		return remote.String()
+	}
+
+	switch k.clientIpSource {
+	case ClientIpFromCloudflare:
+		if ip, err := netip.ParseAddr(strings.TrimSpace(headers.Get("CF-Connecting-IP"))); err == nil {
+			return ip.Unmap().String()
+		}
+	case ClientIpFromForwardedFor:
+		if hops := forwardedHops(headers); len(hops) > 0 {
+			return k.firstUntrustedHop(hops, remote).String()
+		}
+		if ip, err := netip.ParseAddr(strings.TrimSpace(headers.Get("X-Real-IP"))); err == nil {
+			return ip.Unmap().String()
+		}
+	}
+
+	return remote.String()
+}
+
+// firstUntrustedHop walks the forwarded addresses from the closest one and returns the first which isn't a trusted proxy.
+// If all of them are trusted, the farthest one is returned. Walking stops at invalid addresses since anything before
+// them could have been set by the client.
+func (k *Kero) firstUntrustedHop(hops []string, remote netip.Addr) netip.Addr {
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			break
+		}
+
+		client = addr.Unmap()
+		if !k.isTrustedProxy(client) {
+			break
+		}
+	}
+
+	return client
+}
+
+// forwardedHops returns addresses from all X-Forwarded-For headers, in order.
+func forwardedHops(headers http.Header) []string {
+	var hops []string
+	for _, value := range headers.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); len(hop) > 0 {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	return hops
+}
@@ -0,0 +1,58 @@
+package kero
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIp(t *testing.T) {
+	proxies := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+
+	tests := []struct {
+		name       string
+		source     ClientIpSource
+		proxies    []netip.Prefix
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"no proxies", ClientIpFromForwardedFor, nil, "1.1.1.1:1234", map[string]string{"X-Forwarded-For": "2.2.2.2"}, "1.1.1.1"},
+		{"untrusted peer", ClientIpFromForwardedFor, proxies, "1.1.1.1:1234", map[string]string{"X-Forwarded-For": "2.2.2.2"}, "1.1.1.1"},
+		{"trusted peer", ClientIpFromForwardedFor, proxies, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "2.2.2.2"}, "2.2.2.2"},
+		{"spoofed hop", ClientIpFromForwardedFor, proxies, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "6.6.6.6, 2.2.2.2, 10.0.0.2"}, "2.2.2.2"},
+		{"all hops trusted", ClientIpFromForwardedFor, proxies, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.3,10.0.0.2"}, "10.0.0.3"},
+		{"invalid hop", ClientIpFromForwardedFor, proxies, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "2.2.2.2, garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"real ip", ClientIpFromForwardedFor, proxies, "10.0.0.1:1234", map[string]string{"X-Real-IP": "2.2.2.2"}, "2.2.2.2"},
+		{"ipv6", ClientIpFromForwardedFor, proxies, "[fd00::1]:1234", map[string]string{"X-Forwarded-For": "2001:db8::1"}, "2001:db8::1"},
+		{"cloudflare", ClientIpFromCloudflare, proxies, "10.0.0.1:1234", map[string]string{"CF-Connecting-IP": "2.2.2.2", "X-Forwarded-For": "3.3.3.3"}, "2.2.2.2"},
+		{"cloudflare from untrusted peer", ClientIpFromCloudflare, proxies, "1.1.1.1:1234", map[string]string{"CF-Connecting-IP": "2.2.2.2"}, "1.1.1.1"},
+		{"remote addr only", ClientIpFromRemoteAddr, proxies, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "2.2.2.2"}, "10.0.0.1"},
+		{"mapped ipv4", ClientIpFromForwardedFor, proxies, "[::ffff:10.0.0.1]:1234", map[string]string{"X-Forwarded-For": "2.2.2.2"}, "2.2.2.2"},
+		{"invalid remote addr", ClientIpFromForwardedFor, proxies, "", map[string]string{"X-Forwarded-For": "2.2.2.2"}, ""},
+	}
+
+	for _, test := range tests {
+		k := &Kero{trustedProxies: test.proxies, clientIpSource: test.source}
+		headers := http.Header{}
+		for name, value := range test.headers {
+			headers.Set(name, value)
+		}
+
+		if ip := k.clientIp(headers, test.remoteAddr); ip != test.want {
+			t.Error(test.name, "expected", test.want, "got", ip)
+		}
+	}
+}
+
+func TestInvalidClientIpOptions(t *testing.T) {
+	if _, err := New(WithDB(t.TempDir()), WithTrustedProxies([]netip.Prefix{{}})); err == nil {
+		t.Error("should fail with invalid proxy range")
+	}
+	if _, err := New(WithDB(t.TempDir()), WithClientIpSource(ClientIpSource(-1))); err == nil {
+		t.Error("should fail with unknown client IP source")
+	}
+}
@@ -2,15 +2,28 @@ package kero
 
 import (
 	"embed"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
-
-	"github.com/josip/timewarp"
 )
 
+// DashboardExportParam is the query param of the dashboard selecting a stat to export as CSV, see [Dashboard.ExportStat].
+const DashboardExportParam = "export"
+
+// ErrStatNotFound is returned by [Dashboard.ExportStat] for unknown stats.
+var ErrStatNotFound = errors.New("stat not found")
+
 //go:embed index.html
 var dashboardHtml string
 
@@ -32,23 +45,89 @@ type Dashboard struct {
 	Title      string
 	ShowFooter bool
 	BasePath   string
+	Timeframe  Timeframe // Set by [Dashboard.LoadDataForTimeframe]
 
 	VisitorsChartData []BarChartData
 	VisitorsTrend     Trend
 
 	ViewsChartData []BarChartData
 	ViewsTrend     Trend
-	Rows           [][]DashboardStat
+
+	ErrorRateChartData []BarChartData
+	ErrorRateTrend     Trend
+
+	BounceRateTrend    Trend
+	VisitDurationTrend Trend
+	PagesPerVisitTrend Trend
+
+	Funnels      []DashboardFunnel
+	Rows         [][]DashboardStat
+	RouteLatency *RouteLatency // Set when a route is selected with the `route` param, see [Dashboard.LoadDataFromQuery]
+
+	CustomEvents   DashboardStat   // Events tracked by the app or the beacon script, see [Kero.CustomEvents]
+	EventBreakdown *EventBreakdown // Set when an event is selected with the `event` param, see [Dashboard.LoadDataFromQuery]
+
+	WebVitals       []WebVitalStats // Empty if no web vitals were collected in the timeframe, see [WebVitals]
+	WebVitalsByPage DashboardStat
+}
+
+// RouteLatency shows percentiles of durations of a single route over time.
+type RouteLatency struct {
+	Route     string // Method and route, ie. "GET /users/:id"
+	ChartData []BarChartData
+	CloseURL  string // Link to the dashboard without the route
+}
+
+// EventBreakdown shows counts of a custom event by values of one of its labels set by the app.
+type EventBreakdown struct {
+	Event    string
+	Label    string            // Label by which events are counted, empty if the event has no such labels
+	Labels   []TimeframeOption // Links to breakdowns by each of the event's labels
+	Stat     DashboardStat
+	CloseURL string // Link to the dashboard without the event
+}
+
+// WebVitalStats shows the 75th percentile of a web vital over the timeframe and in each of its subdivisions.
+type WebVitalStats struct {
+	WebVital
+	P75       float64
+	Rating    string // Rating of P75, see [WebVital.Rate]
+	Samples   int
+	ChartData []BarChartData
+
+	// Percent of samples by their rating
+	GoodPercent             float64
+	NeedsImprovementPercent float64
+	PoorPercent             float64
 }
 
 type BarChartData struct {
-	Timestamp int64
-	Value     int64
-	Percent   float64
+	Timestamp      int64
+	Value          int64
+	Percent        float64
+	Label          string  // Shown in the tooltip instead of Value if set
+	ComparePercent float64 // Height of the compared period's bar, if CompareLabel is set
+	CompareLabel   string  // Value in the compared period, shown in the tooltip
+
+	measure  float64        // value from which Percent is calculated
+	location *time.Location // timezone of the dashboard's timeframe
 }
 
+// TooltipLabel returns Label if set, otherwise Value.
+func (bcd *BarChartData) TooltipLabel() string {
+	if len(bcd.Label) > 0 {
+		return bcd.Label
+	}
+
+	return strconv.FormatInt(bcd.Value, 10)
+}
+
+// FormattedTimestamp formats the start of the bar's period in the timezone of the dashboard.
 func (bcd *BarChartData) FormattedTimestamp() string {
 	t := time.Unix(bcd.Timestamp, 0)
+	if bcd.location != nil {
+		t = t.In(bcd.location)
+	}
 	if t.Hour() == 0 {
 		return t.Format("Jan 02, 2006")
 	} else {
@@ -58,10 +137,29 @@ func (bcd *BarChartData) FormattedTimestamp() string {
 
 type LabelFormatter func(AggregatedMetric) string
 
+// StatQueryFunc loads data of a stat which can't be described using the other Query... fields of [DashboardStat].
+type StatQueryFunc func(k *Kero, start int64, end int64) ([]AggregatedMetric, error)
+
+// StatColumn is an additional column of the stat showing a value from [AggregatedMetric.Extra].
+type StatColumn struct {
+	Title  string
+	Key    string
+	Format string // fmt verb used for formatting the value, defaults to "%.0f"
+}
+
+func (c StatColumn) FormatValue(value float64) string {
+	if len(c.Format) == 0 {
+		return fmt.Sprintf("%.0f", value)
+	}
+
+	return fmt.Sprintf(c.Format, value)
+}
+
 type DashboardStat struct {
 	Title            string
 	UnitDisplayLabel string
 	CountLabel       string
+	ExtraColumns     []StatColumn
 
 	QueryMetric      string
 	QueryLabel       string
@@ -69,11 +167,64 @@ type DashboardStat struct {
 	QueryFilters     MetricLabels
 	QueryByVisitor   bool
 	QueryAggregateBy AggregationMethod
+	QueryExtra       []AggregationMethod // Added to [AggregatedMetric.Extra], see [Kero.AggregateDistinctWithExtra]
 	QueryExcludeBots bool
+	QueryFunc        StatQueryFunc // Used instead of other Query... fields if set
 
 	FormatLabel LabelFormatter
+	LinkParam   string // Query param of the dashboard set to the row's label when clicked, see [DashboardStat.Link]
+
+	Data        []AggregatedMetric
+	ExportURL   string // Link to download Data as CSV, set by [Dashboard.LoadData], see [Dashboard.ExportStat]
+	Approximate bool   // Values are estimated, see [WithApproximateVisitors]
+
+	previous  map[string]float64 // values by label in the compared period, nil if not compared
+	linkQuery url.Values         // params of the current timeframe
+	goal      bool               // added by [Dashboard.LoadData] for goals configured with [WithGoals]
+}
+
+// Link returns the dashboard URL with LinkParam set to the row's label, or an empty string if LinkParam isn't set.
+func (s DashboardStat) Link(row AggregatedMetric) string {
+	if len(s.LinkParam) == 0 {
+		return ""
+	}
+
+	query := url.Values{}
+	for key, values := range s.linkQuery {
+		query[key] = values
+	}
+	query.Set(s.LinkParam, row.Label)
+
+	return "?" + query.Encode()
+}
+
+// Change returns the change of the row's value from the compared period, or nil if the timeframe isn't compared.
+func (s DashboardStat) Change(row AggregatedMetric) *Change {
+	if s.previous == nil {
+		return nil
+	}
+
+	return &Change{row.Value, s.previous[row.Label]}
+}
 
-	Data []AggregatedMetric
+// DashboardFunnel shows how many visitors went through each of the steps and where they dropped off.
+// See [Kero.Funnel]. Bots are excluded from all steps.
+type DashboardFunnel struct {
+	Title string
+	Steps []FunnelStep
+
+	Data []FunnelStepResult
+
+	previous []FunnelStepResult // nil if not compared
+}
+
+// Change returns the change of visitors who reached the step from the compared period, or nil if the timeframe isn't compared.
+func (f DashboardFunnel) Change(step int) *Change {
+	if f.previous == nil || step >= len(f.previous) || step >= len(f.Data) {
+		return nil
+	}
+
+	return &Change{float64(f.Data[step].Visitors), float64(f.previous[step].Visitors)}
 }
 
 var formFactorEmojis = map[string]string{
@@ -87,6 +238,10 @@ var botFilter = MetricLabels{
 	(BrowserFormFactorLabel + "!="): FormFactorBot,
 }
 
+var serverErrorFilter = MetricLabels{
+	HttpStatusClassLabel: "5xx",
+}
+
 var DefaultDashboard = Dashboard{
 	Title:      "App stats",
 	ShowFooter: true,
@@ -129,6 +284,53 @@ var DefaultDashboard = Dashboard{
 			},
 		},
 
+		{
+			{
+				Title:            "Top entry pages",
+				UnitDisplayLabel: "Page",
+				CountLabel:       "Visits",
+
+				QueryFunc: func(k *Kero, start, end int64) ([]AggregatedMetric, error) {
+					return k.EntryPages(botFilter, start, end)
+				},
+			},
+			{
+				Title:            "Top exit pages",
+				UnitDisplayLabel: "Page",
+				CountLabel:       "Visits",
+				ExtraColumns: []StatColumn{
+					{Title: "Exit rate", Key: ExitRateKey, Format: "%.0f%%"},
+				},
+
+				QueryFunc: func(k *Kero, start, end int64) ([]AggregatedMetric, error) {
+					return k.ExitPages(botFilter, start, end)
+				},
+			},
+		},
+
+		{
+			{
+				Title:            "Top outbound links",
+				UnitDisplayLabel: "Link",
+				CountLabel:       "Visitors",
+
+				QueryMetric:      OutboundClickMetricName,
+				QueryLabel:       LinkUrlLabel,
+				QueryByVisitor:   true,
+				QueryExcludeBots: true,
+			},
+			{
+				Title:            "Top downloads",
+				UnitDisplayLabel: "File",
+				CountLabel:       "Visitors",
+
+				QueryMetric:      FileDownloadMetricName,
+				QueryLabel:       LinkUrlLabel,
+				QueryByVisitor:   true,
+				QueryExcludeBots: true,
+			},
+		},
+
 		// 		{
 		// 			{
 		// 				Title:            "Top UTM sources",
@@ -203,6 +405,33 @@ var DefaultDashboard = Dashboard{
 			},
 		},
 
+		{
+			{
+				Title:            "Top 404 paths",
+				UnitDisplayLabel: "Page",
+				CountLabel:       "Rqs",
+
+				QueryMetric: HttpReqMetricName,
+				QueryFilters: MetricLabels{
+					HttpStatusCodeLabel: "404",
+				},
+				QueryLabel:       HttpPathLabel,
+				QueryExcludeBots: true,
+			},
+
+			{
+				Title:            "Routes with most 5xx",
+				UnitDisplayLabel: "Route",
+				CountLabel:       "Rqs",
+
+				QueryMetric: HttpReqMetricName,
+				QueryFilters: MetricLabels{
+					HttpStatusClassLabel: "5xx",
+				},
+				QueryGroupBy: groupByRoute,
+			},
+		},
+
 		{
 			{
 				Title:            "Top routes",
@@ -218,10 +447,17 @@ var DefaultDashboard = Dashboard{
 				Title:            "Slowest routes",
 				UnitDisplayLabel: "Route",
 				CountLabel:       "avg ms",
+				ExtraColumns: []StatColumn{
+					{Title: "p50", Key: AggregateP50.Name()},
+					{Title: "p95", Key: AggregateP95.Name()},
+					{Title: "p99", Key: AggregateP99.Name()},
+				},
+				LinkParam: "route",
 
 				QueryMetric:      HttpReqDurationMetricName,
 				QueryGroupBy:     groupByRoute,
 				QueryAggregateBy: AggregateAvg,
+				QueryExtra:       []AggregationMethod{AggregateP50, AggregateP95, AggregateP99},
 			},
 
 			{
@@ -247,7 +483,50 @@ func (d *Dashboard) Write(wr io.Writer) error {
 	return dashboardTemplate.Execute(wr, d)
 }
 
-func (d *Dashboard) prepareChartData(rows [][2]int64) (int64, []BarChartData) {
+// prepareRateChartData calculates the percentage of matching events out of totals for each time subdivision.
+// Returned value is the rate for the whole timeframe.
+func (d *Dashboard) prepareRateChartData(matching [][2]int64, totals [][2]int64) (float64, []BarChartData) {
+	var chartData []BarChartData
+
+	matchingSum, totalSum := int64(0), int64(0)
+	rates := make([]float64, len(matching))
+	maxRate := 0.0
+
+	for i, row := range matching {
+		matchingSum += row[1]
+		if i < len(totals) && totals[i][1] > 0 {
+			totalSum += totals[i][1]
+			rates[i] = float64(row[1]) / float64(totals[i][1]) * 100
+		}
+		if rates[i] > maxRate {
+			maxRate = rates[i]
+		}
+	}
+
+	for i, row := range matching {
+		percent := 0.0
+		if maxRate > 0 {
+			percent = rates[i] / maxRate * 100
+		}
+
+		chartData = append(chartData, BarChartData{
+			Timestamp: row[0],
+			Value:     row[1],
+			Percent:   percent,
+			Label:     fmt.Sprintf("%.2f%% (%d)", rates[i], row[1]),
+			measure:   rates[i],
+			location:  d.Timeframe.Location,
+		})
+	}
+
+	if totalSum == 0 {
+		return 0, chartData
+	}
+
+	return float64(matchingSum) / float64(totalSum) * 100, chartData
+}
+
+func (d *Dashboard) prepareChartData(rows [][2]int64) (float64, []BarChartData) {
 	var chartData []BarChartData
 
 	count := int64(0)
@@ -265,84 +544,470 @@ func (d *Dashboard) prepareChartData(rows [][2]int64) (int64, []BarChartData) {
 			Timestamp: row[0],
 			Value:     row[1],
 			Percent:   (float64(row[1]) / float64(max) * 100),
+			measure:   float64(row[1]),
+			location:  d.Timeframe.Location,
 		})
 	}
 
-	return count, chartData
+	return float64(count), chartData
+}
+
+// overlayComparison adds bars of the compared period to the chart, matched by their position,
+// and scales bars of both periods to the same maximum.
+func overlayComparison(chartData []BarChartData, compared []BarChartData) {
+	highest := 0.0
+	for _, bar := range chartData {
+		highest = max(highest, bar.measure)
+	}
+	for _, bar := range compared {
+		highest = max(highest, bar.measure)
+	}
+	if highest == 0 {
+		return
+	}
+
+	for i := range chartData {
+		chartData[i].Percent = chartData[i].measure / highest * 100
+		if i < len(compared) {
+			chartData[i].ComparePercent = compared[i].measure / highest * 100
+			chartData[i].CompareLabel = compared[i].TooltipLabel() + " on " + compared[i].FormattedTimestamp()
+		}
+	}
 }
 
-func (d *Dashboard) loadDataForTimeframe(k *Kero, start, end int64) {
-	// not 100% accurate
-	prevPeriodStart := start - (end - start)
+func (d *Dashboard) loadData(k *Kero, tf Timeframe) {
+	start, end := tf.Start, tf.End
+	comparedTo := tf.Compare.Description()
+	splits := k.histogramSplits(tf.Interval, start, end, tf.Location)
 
-	visitors := k.VisitorsHistogram(HttpReqMetricName, botFilter, start, end)
+	visitors := k.visitorsHistogram(HttpReqMetricName, botFilter, splits)
+	d.VisitorsTrend = Trend{Approximate: k.approximateVisitors, ComparedTo: comparedTo}
 	d.VisitorsTrend.CurrentValue, d.VisitorsChartData = d.prepareChartData(visitors)
-	if prevCount, err := k.CountVisitors(HttpReqMetricName, botFilter, prevPeriodStart, start); err == nil {
-		d.VisitorsTrend.PreviousValue = int64(prevCount)
-	}
 
-	views := k.CountHistogram(HttpReqMetricName, start, end)
+	views := k.countHistogram(HttpReqMetricName, nil, splits)
+	d.ViewsTrend = Trend{ComparedTo: comparedTo}
 	d.ViewsTrend.CurrentValue, d.ViewsChartData = d.prepareChartData(views)
-	d.ViewsTrend.PreviousValue = int64(k.Count(HttpReqMetricName, prevPeriodStart, start))
+
+	serverErrors := k.countHistogram(HttpReqMetricName, serverErrorFilter, splits)
+	d.ErrorRateTrend = Trend{Unit: TrendUnitPercent, LowerIsBetter: true, ComparedTo: comparedTo}
+	d.ErrorRateTrend.CurrentValue, d.ErrorRateChartData = d.prepareRateChartData(serverErrors, views)
+
+	if tf.Compared() {
+		var prevChartData []BarChartData
+		prevSplits := k.histogramSplits(tf.Interval, tf.CompareStart, tf.CompareEnd, tf.Location)
+		prevVisitors := k.visitorsHistogram(HttpReqMetricName, botFilter, prevSplits)
+		d.VisitorsTrend.PreviousValue, prevChartData = d.prepareChartData(prevVisitors)
+		overlayComparison(d.VisitorsChartData, prevChartData)
+
+		prevViews := k.countHistogram(HttpReqMetricName, nil, prevSplits)
+		d.ViewsTrend.PreviousValue, prevChartData = d.prepareChartData(prevViews)
+		overlayComparison(d.ViewsChartData, prevChartData)
+
+		prevErrors := k.countHistogram(HttpReqMetricName, serverErrorFilter, prevSplits)
+		d.ErrorRateTrend.PreviousValue, prevChartData = d.prepareRateChartData(prevErrors, prevViews)
+		overlayComparison(d.ErrorRateChartData, prevChartData)
+	}
+
+	d.BounceRateTrend = Trend{Unit: TrendUnitPercent, LowerIsBetter: true, ComparedTo: comparedTo}
+	d.VisitDurationTrend = Trend{Unit: TrendUnitDuration, ComparedTo: comparedTo}
+	d.PagesPerVisitTrend = Trend{Unit: TrendUnitDecimal, ComparedTo: comparedTo}
+	if sessions, err := k.SessionStats(botFilter, start, end); err == nil {
+		d.BounceRateTrend.CurrentValue = sessions.BounceRate
+		d.VisitDurationTrend.CurrentValue = sessions.AvgDuration.Seconds()
+		d.PagesPerVisitTrend.CurrentValue = sessions.PagesPerSession
+	}
+	if tf.Compared() {
+		if prevSessions, err := k.SessionStats(botFilter, tf.CompareStart, tf.CompareEnd); err == nil {
+			d.BounceRateTrend.PreviousValue = prevSessions.BounceRate
+			d.VisitDurationTrend.PreviousValue = prevSessions.AvgDuration.Seconds()
+			d.PagesPerVisitTrend.PreviousValue = prevSessions.PagesPerSession
+		}
+	}
+
+	for i := range d.Funnels {
+		funnel := &d.Funnels[i]
+		funnel.previous = nil
+		if err := funnel.runQuery(k, start, end); err != nil {
+			fmt.Println("Error while running dashboard funnel", funnel.Title, err)
+		}
+		if tf.Compared() {
+			prev := *funnel
+			if err := prev.runQuery(k, tf.CompareStart, tf.CompareEnd); err == nil {
+				funnel.previous = prev.Data
+			}
+		}
+	}
 
 	for i := range d.Rows {
 		for j := range d.Rows[i] {
-			if err := d.Rows[i][j].runQuery(k, start, end); err != nil {
-				fmt.Println("Error while running dashboard query", d.Rows[i][j].Title, err)
+			d.Rows[i][j].loadData(k, tf)
+		}
+	}
+
+	d.CustomEvents = customEventsStat
+	d.CustomEvents.loadData(k, tf)
+}
+
+// loadData runs the stat's query for the timeframe and the period it's compared to.
+func (s *DashboardStat) loadData(k *Kero, tf Timeframe) {
+	s.previous = nil
+	s.linkQuery = tf.Query()
+	s.ExportURL = statExportURL(s.linkQuery, s.Key())
+	if err := s.runQuery(k, tf.Start, tf.End); err != nil {
+		fmt.Println("Error while running dashboard query", s.Title, err)
+	}
+	if tf.Compared() {
+		prev := *s
+		if err := prev.runQuery(k, tf.CompareStart, tf.CompareEnd); err == nil {
+			s.previous = make(map[string]float64, len(prev.Data))
+			for _, row := range prev.Data {
+				s.previous[row.Label] = row.Value
 			}
 		}
 	}
 }
 
+// LoadData loads data of one of the [TimeframePresets], compared to the previous period.
+// See [Dashboard.LoadDataFromQuery] for custom timeframes and comparisons.
 func (d *Dashboard) LoadData(k *Kero, timeframe string) {
-	if len(timeframe) == 0 {
-		timeframe = "t"
+	tf, err := ParseTimeframe(url.Values{"t": {timeframe}}, k.location)
+	if err != nil {
+		// unknown presets are handled by ParseTimeframe, so this shouldn't happen
+		fmt.Println("[kero] invalid timeframe", timeframe, err)
+		return
+	}
+
+	d.LoadDataForTimeframe(k, tf)
+}
+
+// LoadDataFromQuery loads data of the timeframe described by query params of the dashboard request, see [ParseTimeframe].
+// Latency of a route is loaded as well if it's selected with the `route` param, ie. `route=GET /users/:id`,
+// and a breakdown of a custom event if it's selected with the `event` param and optionally `event_label`, ie. `event=signup&event_label=plan`.
+// No data is loaded if params are invalid.
+func (d *Dashboard) LoadDataFromQuery(k *Kero, query url.Values) error {
+	tf, err := ParseTimeframe(query, k.location)
+	if err != nil {
+		return err
+	}
+
+	d.LoadDataForTimeframe(k, tf)
+	if route := query.Get("route"); len(route) > 0 {
+		d.loadRouteLatency(k, route)
+	}
+	if event := query.Get("event"); len(event) > 0 {
+		d.loadEventBreakdown(k, event, query.Get("event_label"))
+	}
+	return nil
+}
+
+// loadEventBreakdown loads counts of the custom event by values of the label,
+// or of its first label set by the app if the label isn't one of them.
+func (d *Dashboard) loadEventBreakdown(k *Kero, event string, label string) {
+	tf := d.Timeframe
+	labels, err := k.EventProperties(event, tf.Start, tf.End)
+	if err != nil {
+		fmt.Println("[kero] failed to load labels of", event, err)
+		return
+	}
+	if !slices.Contains(labels, label) {
+		label = ""
+		if len(labels) > 0 {
+			label = labels[0]
+		}
+	}
+
+	query := tf.Query()
+	query.Set("event", event)
+	breakdown := &EventBreakdown{
+		Event:    event,
+		Label:    label,
+		Labels:   make([]TimeframeOption, len(labels)),
+		CloseURL: "?" + tf.Query().Encode(),
+	}
+	for i, name := range labels {
+		query.Set("event_label", name)
+		breakdown.Labels[i] = TimeframeOption{Label: name, URL: "?" + query.Encode(), Active: name == label}
+	}
+
+	if len(label) > 0 {
+		breakdown.Stat = eventBreakdownStat(event, label)
+		breakdown.Stat.loadData(k, tf)
+		query.Set("event_label", label)
+		breakdown.Stat.ExportURL = statExportURL(query, breakdown.Stat.Key())
+	}
+
+	d.EventBreakdown = breakdown
+}
+
+func eventBreakdownStat(event string, label string) DashboardStat {
+	return DashboardStat{
+		Title:            event + " by " + label,
+		UnitDisplayLabel: label,
+		CountLabel:       "Events",
+		ExtraColumns:     []StatColumn{{Title: "Visitors", Key: VisitorsKey}},
+
+		QueryFunc: func(k *Kero, start, end int64) ([]AggregatedMetric, error) {
+			return k.CountEventsByLabel(event, label, botFilter, start, end)
+		},
+	}
+}
+
+// loadRouteLatency loads the 95th percentile of durations of the route in each subdivision of the timeframe,
+// with the median and the 99th percentile shown in the tooltip.
+func (d *Dashboard) loadRouteLatency(k *Kero, route string) {
+	tf := d.Timeframe
+	method, path, _ := strings.Cut(route, " ")
+	filters := MetricLabels{HttpMethodLabel: method, HttpRouteLabel: path}
+
+	splits := k.histogramSplits(tf.Interval, tf.Start, tf.End, tf.Location)
+	stats, err := k.valueStatsInSplits(HttpReqDurationMetricName, filters, splits, true)
+	if err != nil {
+		fmt.Println("[kero] failed to load latency of", route, err)
+		return
+	}
+
+	highest := 0.0
+	for _, split := range stats {
+		highest = max(highest, split.aggregate(AggregateP95))
+	}
+
+	chartData := make([]BarChartData, len(splits))
+	for i, split := range splits {
+		p95 := stats[i].aggregate(AggregateP95)
+		chartData[i] = BarChartData{
+			Timestamp: split[0],
+			Value:     int64(math.Round(p95)),
+			Label: fmt.Sprintf(
+				"p50 %.1f ms, p95 %.1f ms, p99 %.1f ms (%.0f rqs)",
+				stats[i].aggregate(AggregateP50), p95, stats[i].aggregate(AggregateP99), stats[i].count,
+			),
+			measure:  p95,
+			location: tf.Location,
+		}
+		if highest > 0 {
+			chartData[i].Percent = p95 / highest * 100
+		}
+	}
+
+	d.RouteLatency = &RouteLatency{
+		Route:     route,
+		ChartData: chartData,
+		CloseURL:  "?" + tf.Query().Encode(),
+	}
+}
+
+// loadWebVitals loads the 75th percentile of each of the [WebVitals] and the 75th percentiles by page.
+// Nothing is loaded if no vitals were collected in the timeframe.
+func (d *Dashboard) loadWebVitals(k *Kero, tf Timeframe) {
+	d.WebVitals = nil
+	d.WebVitalsByPage = DashboardStat{}
+
+	splits := k.histogramSplits(tf.Interval, tf.Start, tf.End, tf.Location)
+	vitals := make([]WebVitalStats, len(WebVitals))
+	samples := 0
+	for i, vital := range WebVitals {
+		stats, err := k.valueStatsInSplits(vital.Metric, botFilter, splits, true)
+		if err != nil {
+			fmt.Println("[kero] failed to load web vital", vital.Name, err)
+			return
+		}
+
+		vitals[i] = newWebVitalStats(vital, stats, splits, tf.Location)
+		samples += vitals[i].Samples
+	}
+	if samples == 0 {
+		return
+	}
+
+	d.WebVitals = vitals
+	d.WebVitalsByPage = webVitalsByPageStat
+	d.WebVitalsByPage.ExportURL = statExportURL(tf.Query(), d.WebVitalsByPage.Key())
+	if err := d.WebVitalsByPage.runQuery(k, tf.Start, tf.End); err != nil {
+		fmt.Println("[kero] failed to load web vitals by page", err)
+	}
+}
+
+func newWebVitalStats(vital WebVital, stats []*valueStats, splits [][2]int64, loc *time.Location) WebVitalStats {
+	total := &valueStats{}
+	ratings := map[string]float64{}
+	highest := 0.0
+	for _, split := range stats {
+		for _, value := range split.values {
+			total.add(value, true)
+			ratings[vital.Rate(value)] += 1
+		}
+		highest = max(highest, split.aggregate(AggregateP75))
+	}
+
+	vs := WebVitalStats{
+		WebVital: vital,
+		P75:      total.aggregate(AggregateP75),
+		Samples:  int(total.count),
+	}
+	vs.Rating = vital.Rate(vs.P75)
+	if total.count > 0 {
+		vs.GoodPercent = ratings[WebVitalGood] / total.count * 100
+		vs.NeedsImprovementPercent = ratings[WebVitalNeedsImprovement] / total.count * 100
+		vs.PoorPercent = ratings[WebVitalPoor] / total.count * 100
+	}
+
+	vs.ChartData = make([]BarChartData, len(splits))
+	for i, split := range splits {
+		p75 := stats[i].aggregate(AggregateP75)
+		vs.ChartData[i] = BarChartData{
+			Timestamp: split[0],
+			Value:     int64(math.Round(p75)),
+			Label:     fmt.Sprintf("p75 %s (%.0f samples)", vital.Format(p75), stats[i].count),
+			measure:   p75,
+			location:  loc,
+		}
+		if highest > 0 {
+			vs.ChartData[i].Percent = p75 / highest * 100
+		}
+	}
+
+	return vs
+}
+
+// LoadDataForTimeframe loads data of the timeframe and the period it's compared to.
+// Days start in the timeframe's location, or the one set with [WithTimezone] if it's nil.
+func (d *Dashboard) LoadDataForTimeframe(k *Kero, tf Timeframe) {
+	if tf.Location == nil {
+		tf.Location = k.location
+	}
+	d.Timeframe = tf
+	d.RouteLatency = nil
+	d.EventBreakdown = nil
+	// funnels and stats are usually shared through DefaultDashboard so data is loaded into copies
+	d.Funnels = append([]DashboardFunnel(nil), d.Funnels...)
+	d.Rows = d.allRows(k)
+	d.loadData(k, tf)
+	d.loadWebVitals(k, tf)
+
+	for i := range d.Rows {
+		for j := range d.Rows[i] {
+			d.Rows[i][j].Approximate = k.approximateVisitors && d.Rows[i][j].QueryByVisitor
+		}
 	}
-	start, end := parseTimeframeString(timeframe)
-	d.loadDataForTimeframe(k, start, end)
 	// TODO this should be probably somewhere else it's needed here to build correct path
 	// to .css and .js assets in the outputted HTML
 	d.BasePath = k.DashboardPath
 }
 
+// TimeframeOption is a link shown in the dashboard's selectors, ie. of the timeframe, comparison or label of an event.
+type TimeframeOption struct {
+	Label  string
+	URL    string
+	Active bool
+}
+
+// TimeframeOptions returns links to each of the [TimeframePresets], keeping the current comparison.
+func (d Dashboard) TimeframeOptions() []TimeframeOption {
+	options := make([]TimeframeOption, len(TimeframePresets))
+	for i, preset := range TimeframePresets {
+		tf := d.Timeframe
+		tf.Preset = preset.Key
+		options[i] = TimeframeOption{preset.Label, "?" + tf.Query().Encode(), preset.Key == d.Timeframe.Preset}
+	}
+
+	return options
+}
+
+// CompareOptions returns links to the current timeframe with each of the compare modes.
+func (d Dashboard) CompareOptions() []TimeframeOption {
+	modes := []struct {
+		mode  CompareMode
+		label string
+	}{
+		{ComparePrevious, "Compare to previous period"},
+		{CompareYearAgo, "Compare to last year"},
+		{CompareNone, "No comparison"},
+	}
+
+	options := make([]TimeframeOption, len(modes))
+	for i, m := range modes {
+		tf := d.Timeframe
+		tf.Compare = m.mode
+		options[i] = TimeframeOption{m.label, "?" + tf.Query().Encode(), m.mode == d.Timeframe.Compare}
+	}
+
+	return options
+}
+
+type TrendUnit int
+
+const (
+	TrendUnitCount    TrendUnit = iota // Whole numbers, ie. number of visitors
+	TrendUnitPercent                   // Percentages, ie. error rate
+	TrendUnitDuration                  // Durations in seconds, ie. visit duration
+	TrendUnitDecimal                   // Fractional numbers, ie. pages per visit
+)
+
 type Trend struct {
-	CurrentValue  int64
-	PreviousValue int64
+	CurrentValue  float64 // float64 since error rates were added, int64 in older versions
+	PreviousValue float64
+	Unit          TrendUnit
+	LowerIsBetter bool   // Shows an increase as a negative change, ie. for error rates
+	Approximate   bool   // Values are estimated, see [WithApproximateVisitors]
+	ComparedTo    string // Description of the period of PreviousValue, the change isn't shown if empty
 }
 
 func (t *Trend) PercentChange() float64 {
-	return float64(t.CurrentValue-t.PreviousValue) / float64(t.PreviousValue) * 100
+	return (t.CurrentValue - t.PreviousValue) / t.PreviousValue * 100
+}
+
+// Format formats the value according to the trend's unit.
+func (t *Trend) Format(value float64) string {
+	switch t.Unit {
+	case TrendUnitPercent:
+		return fmt.Sprintf("%.2f%%", value)
+	case TrendUnitDuration:
+		return (time.Duration(value) * time.Second).String()
+	case TrendUnitDecimal:
+		return fmt.Sprintf("%.2f", value)
+	default:
+		return fmt.Sprintf("%.0f", value)
+	}
 }
 
-func parseTimeframeString(tf string) (int64, int64) {
-	eod := timewarp.Now().EndOfDay().Time.Unix()
+func parseTimeframeString(tf string, loc *time.Location) (int64, int64) {
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	// days are added in calendar days so they start at midnight even across DST changes
+	eod := today.AddDate(0, 0, 1).Unix() - 1
 
 	switch tf {
 	case "t":
-		return timewarp.Today().Time.Unix(), eod
+		return today.Unix(), eod
 	case "24h":
-		return timewarp.Now().SubHours(24).Time.Unix(), timewarp.Now().Time.Unix()
+		return now.Add(-24 * time.Hour).Unix(), now.Unix()
 	case "7d":
-		return timewarp.Today().SubDays(7).Time.Unix(), eod
+		return today.AddDate(0, 0, -7).Unix(), eod
 	case "30d":
-		return timewarp.Today().SubDays(30).Time.Unix(), eod
+		return today.AddDate(0, 0, -30).Unix(), eod
 	case "12m":
 		// actually from 1st of the month from 1y ago
-		mth := timewarp.Now().Time
-		return mth.AddDate(0, -12, -mth.Day()+1).Unix(), eod
+		return today.AddDate(0, -12, -today.Day()+1).Unix(), eod
 	case "mtd":
-		mtd := timewarp.Today().Time
-		return mtd.AddDate(0, 0, -mtd.Day()+1).Unix(), eod
+		return today.AddDate(0, 0, -today.Day()+1).Unix(), eod
 	case "ytd":
-		ytd := timewarp.Today().Time
-		return ytd.AddDate(0, -int(ytd.Month()-1), -ytd.Day()+1).Unix(), eod
+		return time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, loc).Unix(), eod
 	default:
 		// defaults to "today"
-		return timewarp.Now().Time.Unix(), eod
+		return now.Unix(), eod
 	}
 }
 
+// Columns returns the total number of columns in the stat's table.
+func (s DashboardStat) Columns() int {
+	return 2 + len(s.ExtraColumns)
+}
+
 func (s *DashboardStat) validate() error {
+	if s.QueryFunc != nil {
+		return nil
+	}
+
 	if len(s.QueryMetric) == 0 {
 		return errors.New("missing QueryMetric")
 	}
@@ -359,26 +1024,31 @@ func (s *DashboardStat) runQuery(k *Kero, start, end int64) error {
 		return err
 	}
 
+	// filters are copied as stats are shared between requests
+	filters := MetricLabels{}
+	for label, value := range s.QueryFilters {
+		filters[label] = value
+	}
 	if s.QueryExcludeBots {
-		if s.QueryFilters == nil {
-			s.QueryFilters = botFilter
-		} else {
-			s.QueryFilters[BrowserFormFactorLabel+"!="] = FormFactorBot
-		}
+		filters[BrowserFormFactorLabel+"!="] = FormFactorBot
 	}
 
 	var err error
-	if len(s.QueryLabel) > 0 {
+	if s.QueryFunc != nil {
+		s.Data, err = s.QueryFunc(k, start, end)
+	} else if len(s.QueryLabel) > 0 {
 		if s.QueryByVisitor {
-			s.Data, err = k.CountDistinctByVisitorAndLabel(s.QueryMetric, s.QueryLabel, s.QueryFilters, start, end)
+			s.Data, err = k.CountDistinctByVisitorAndLabel(s.QueryMetric, s.QueryLabel, filters, start, end)
+		} else if len(s.QueryExtra) > 0 {
+			s.Data, err = k.AggregateDistinctWithExtra(s.QueryMetric, groupByLabel(s.QueryLabel), filters, s.QueryAggregateBy, s.QueryExtra, start, end)
 		} else {
-			s.Data, err = k.AggregateDistinct(s.QueryMetric, groupByLabel(s.QueryLabel), s.QueryFilters, s.QueryAggregateBy, start, end)
+			s.Data, err = k.AggregateDistinctByLabel(s.QueryMetric, s.QueryLabel, filters, s.QueryAggregateBy, start, end)
 		}
 	} else if s.QueryGroupBy != nil {
 		if s.QueryByVisitor {
-			s.Data, err = k.CountDistinctByVisitor(s.QueryMetric, s.QueryGroupBy, s.QueryFilters, start, end)
+			s.Data, err = k.CountDistinctByVisitor(s.QueryMetric, s.QueryGroupBy, filters, start, end)
 		} else {
-			s.Data, err = k.AggregateDistinct(s.QueryMetric, s.QueryGroupBy, s.QueryFilters, s.QueryAggregateBy, start, end)
+			s.Data, err = k.AggregateDistinctWithExtra(s.QueryMetric, s.QueryGroupBy, filters, s.QueryAggregateBy, s.QueryExtra, start, end)
 		}
 	}
 
@@ -394,3 +1064,210 @@ func (s *DashboardStat) runQuery(k *Kero, start, end int64) error {
 
 	return nil
 }
+
+func (f *DashboardFunnel) runQuery(k *Kero, start, end int64) error {
+	steps := make([]FunnelStep, len(f.Steps))
+	for i, step := range f.Steps {
+		steps[i] = step
+		steps[i].Filters = mergeMaps(step.Filters, botFilter)
+	}
+
+	data, err := k.Funnel(steps, start, end)
+	f.Data = data
+	return err
+}
+
+// allRows returns copies of stats shown on the dashboard, including goals configured with [WithGoals].
+// Goal rows added by a previous load are replaced, so the same dashboard can be loaded again.
+func (d *Dashboard) allRows(k *Kero) [][]DashboardStat {
+	rows := [][]DashboardStat{}
+	if len(k.goals) > 0 {
+		rows = append(rows, goalRows(k.goals)...)
+	}
+	for _, row := range d.Rows {
+		if len(row) > 0 && row[0].goal {
+			continue
+		}
+		rows = append(rows, append([]DashboardStat(nil), row...))
+	}
+
+	return rows
+}
+
+// goalRows creates stats with conversions of all goals followed by a breakdown of each goal by its source.
+func goalRows(goals []Goal) [][]DashboardStat {
+	rows := [][]DashboardStat{{
+		{
+			Title:            "Goals",
+			UnitDisplayLabel: "Goal",
+			CountLabel:       "Visitors",
+			ExtraColumns: []StatColumn{
+				{Title: "Completions", Key: GoalCompletionsKey},
+				{Title: "Conversion", Key: ConversionRateKey, Format: "%.1f%%"},
+			},
+			QueryFunc: queryGoals,
+			goal:      true,
+		},
+	}}
+
+	for _, goal := range goals {
+		rows = append(rows, []DashboardStat{
+			{
+				Title:            goal.Name + " by referrer",
+				UnitDisplayLabel: "Domain",
+				CountLabel:       "Visitors",
+				QueryFunc:        queryGoalBreakdown(goal.Name, ReferrerDomainLabel),
+				goal:             true,
+			},
+			{
+				Title:            goal.Name + " by UTM source",
+				UnitDisplayLabel: "Source",
+				CountLabel:       "Visitors",
+				QueryFunc:        queryGoalBreakdown(goal.Name, UTMSourceLabel),
+				goal:             true,
+			},
+		})
+	}
+
+	return rows
+}
+
+func queryGoals(k *Kero, start int64, end int64) ([]AggregatedMetric, error) {
+	stats, err := k.GoalStats(start, end)
+	if err != nil {
+		return []AggregatedMetric{}, err
+	}
+
+	data := []AggregatedMetric{}
+	for _, goal := range stats {
+		if goal.Completions == 0 {
+			continue
+		}
+
+		data = append(data, AggregatedMetric{
+			Label: goal.Name,
+			Value: float64(goal.Visitors),
+			Extra: map[string]float64{
+				GoalCompletionsKey: float64(goal.Completions),
+				ConversionRateKey:  goal.ConversionRate,
+			},
+		})
+	}
+
+	sort.SliceStable(data, func(i, j int) bool { return data[i].Value > data[j].Value })
+
+	return data, nil
+}
+
+func queryGoalBreakdown(name string, label string) StatQueryFunc {
+	return func(k *Kero, start int64, end int64) ([]AggregatedMetric, error) {
+		return k.GoalBreakdown(name, label, start, end)
+	}
+}
+
+// WriteCSV writes the loaded data of the stat as CSV, with the same columns as shown on the dashboard.
+func (s *DashboardStat) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{s.UnitDisplayLabel, s.CountLabel}
+	for _, column := range s.ExtraColumns {
+		header = append(header, column.Title)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, row := range s.Data {
+		record := []string{row.Label, strconv.FormatFloat(row.Value, 'f', -1, 64)}
+		for _, column := range s.ExtraColumns {
+			record = append(record, strconv.FormatFloat(row.Extra[column.Key], 'f', -1, 64))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// statExportURL returns the dashboard URL with the params of the query exporting the stat, see [Dashboard.ExportStat].
+func statExportURL(query url.Values, key string) string {
+	query = maps.Clone(query)
+	query.Set("compare", string(CompareNone))
+	query.Set(DashboardExportParam, key)
+
+	return "?" + query.Encode()
+}
+
+// Key identifies the stat within the dashboard in [DashboardStat.ExportURL], ie. "top-pages" for "Top pages".
+func (s DashboardStat) Key() string {
+	return exportFileName(s.Title)
+}
+
+// ExportStat loads only the stat selected by the [DashboardExportParam] of the query, as linked by [DashboardStat.ExportURL],
+// which can be then written with [DashboardStat.WriteCSV]. Other params are read as with [Dashboard.LoadDataFromQuery].
+// Apps serving their own dashboards should call it instead of loading all data when the param is set.
+// Returns [ErrStatNotFound] if none of the dashboard's stats has the key.
+func (d *Dashboard) ExportStat(k *Kero, query url.Values) (*DashboardStat, error) {
+	tf, err := ParseTimeframe(query, k.location)
+	if err != nil {
+		return nil, err
+	}
+	d.Timeframe = tf
+	d.Rows = d.allRows(k)
+	d.CustomEvents = customEventsStat
+	d.WebVitalsByPage = webVitalsByPageStat
+	d.EventBreakdown = nil
+
+	stats := []*DashboardStat{&d.CustomEvents, &d.WebVitalsByPage}
+	for i := range d.Rows {
+		for j := range d.Rows[i] {
+			stats = append(stats, &d.Rows[i][j])
+		}
+	}
+	if event, label := query.Get("event"), query.Get("event_label"); len(event) > 0 && len(label) > 0 {
+		d.EventBreakdown = &EventBreakdown{Event: event, Label: label, Stat: eventBreakdownStat(event, label)}
+		stats = append(stats, &d.EventBreakdown.Stat)
+	}
+
+	key := query.Get(DashboardExportParam)
+	for _, stat := range stats {
+		if stat.Key() == key {
+			stat.loadData(k, tf)
+			return stat, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrStatNotFound, key)
+}
+
+// ServeStatCSV responds with the stat selected by the query as a CSV file, see [Dashboard.ExportStat].
+func (d *Dashboard) ServeStatCSV(k *Kero, w http.ResponseWriter, query url.Values) {
+	stat, err := d.ExportStat(k, query)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrStatNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", ExportCSV.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, d.ExportFileName(stat)))
+	if err := stat.WriteCSV(w); err != nil {
+		// response has already started so the error can't be reported to the client
+		fmt.Println("[kero] error exporting stat", stat.Title, err)
+	}
+}
+
+// ExportFileName returns the name of the CSV file with the stat's data, ie. "top-pages-7d.csv".
+func (d *Dashboard) ExportFileName(stat *DashboardStat) string {
+	timeframe := d.Timeframe.Preset
+	if len(timeframe) == 0 {
+		timeframe = d.Timeframe.FromDate() + "-" + d.Timeframe.ToDate()
+	}
+
+	return exportFileName(stat.Title) + "-" + exportFileName(timeframe) + ".csv"
+}
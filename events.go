@@ -0,0 +1,149 @@
+package kero
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// VisitorsKey is the key in [AggregatedMetric.Extra] with the number of unique visitors.
+const VisitorsKey = "visitors"
+
+// eventCounter counts events of a group and its unique visitors, which are estimated with [WithApproximateVisitors].
+type eventCounter struct {
+	count    float64
+	visitors map[string]struct{}
+	sketch   *hyperLogLog
+}
+
+func (k *Kero) newEventCounter() *eventCounter {
+	if k.approximateVisitors {
+		return &eventCounter{sketch: newHyperLogLog()}
+	}
+
+	return &eventCounter{visitors: make(map[string]struct{})}
+}
+
+func (c *eventCounter) add(visitorId string) {
+	c.count += 1
+	if len(visitorId) == 0 {
+		return
+	}
+
+	if c.sketch != nil {
+		c.sketch.Add(visitorId)
+	} else {
+		c.visitors[visitorId] = struct{}{}
+	}
+}
+
+func (c *eventCounter) uniqueVisitors() float64 {
+	if c.sketch != nil {
+		return float64(c.sketch.Estimate())
+	}
+
+	return float64(len(c.visitors))
+}
+
+// countEvents counts matching events and their unique visitors in a single pass, grouped by the calculated key.
+func (k *Kero) countEvents(metric string, groupBy GroupMetricBy, labelFilters MetricLabels, start int64, end int64) ([]AggregatedMetric, error) {
+	counters := make(map[string]*eventCounter)
+	for m, err := range k.QueryIter(metric, labelFilters, start, end) {
+		if err != nil {
+			return []AggregatedMetric{}, err
+		}
+
+		id := groupBy(m)
+		if len(id) == 0 {
+			continue
+		}
+		counter, exists := counters[id]
+		if !exists {
+			counter = k.newEventCounter()
+			counters[id] = counter
+		}
+		counter.add(m.Labels[VisitorIdLabel])
+	}
+
+	allMetrics := make([]AggregatedMetric, 0, len(counters))
+	for id, counter := range counters {
+		allMetrics = append(allMetrics, AggregatedMetric{
+			Label: id,
+			Value: counter.count,
+			Extra: map[string]float64{VisitorsKey: counter.uniqueVisitors()},
+		})
+	}
+	sortByValue(allMetrics)
+
+	return allMetrics, nil
+}
+
+// sortByValue sorts rows by the highest value first, and by their label if values are the same.
+func sortByValue(rows []AggregatedMetric) {
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Value == rows[j].Value {
+			return rows[i].Label < rows[j].Label
+		}
+		return rows[i].Value > rows[j].Value
+	})
+}
+
+// isCustomEvent returns true for metrics tracked by the app or the beacon script,
+// as opposed to requests (http_req*) and measurements of [WebVitals].
+func isCustomEvent(metric string) bool {
+	return !strings.HasPrefix(metric, HttpReqMetricName) && !strings.HasPrefix(metric, WebVitalMetricPrefix)
+}
+
+// CustomEvents counts events of each custom metric tracked in the timeframe, ie. with [Kero.TrackOneWithRequest]
+// or by the beacon script, with the metric's name as the label and the number of unique visitors
+// under [VisitorsKey] in [AggregatedMetric.Extra]. Requests and [WebVitals] aren't included.
+func (k *Kero) CustomEvents(labelFilters MetricLabels, start int64, end int64) ([]AggregatedMetric, error) {
+	names, err := k.MetricNames(start, end)
+	if err != nil {
+		return []AggregatedMetric{}, err
+	}
+
+	events := []AggregatedMetric{}
+	for _, name := range slices.DeleteFunc(names, func(name string) bool { return !isCustomEvent(name) }) {
+		counts, err := k.countEvents(name, func(Metric) string { return name }, labelFilters, start, end)
+		if err != nil {
+			return []AggregatedMetric{}, err
+		}
+		events = append(events, counts...)
+	}
+	sortByValue(events)
+
+	return events, nil
+}
+
+// CountEventsByLabel counts events of the metric grouped by values of the label, with the number of unique visitors
+// under [VisitorsKey] in [AggregatedMetric.Extra]. Events without the label are excluded.
+func (k *Kero) CountEventsByLabel(metric string, label string, labelFilters MetricLabels, start int64, end int64) ([]AggregatedMetric, error) {
+	return k.countEvents(metric, groupByLabel(label), labelFilters, start, end)
+}
+
+// EventProperties returns sorted names of labels of the metric's events set by the app or the beacon script,
+// ie. props of custom events, excluding labels set by Kero which start with $.
+func (k *Kero) EventProperties(metric string, start int64, end int64) ([]string, error) {
+	names, err := k.LabelNames(metric, nil, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(names, func(name string) bool {
+		return strings.HasPrefix(name, "$") || strings.HasPrefix(name, "__")
+	}), nil
+}
+
+// customEventsStat lists custom events with links to their breakdown by labels, see [Dashboard.LoadDataFromQuery].
+var customEventsStat = DashboardStat{
+	Title:            "Custom events",
+	UnitDisplayLabel: "Event",
+	CountLabel:       "Events",
+	ExtraColumns:     []StatColumn{{Title: "Visitors", Key: VisitorsKey}},
+	LinkParam:        "event",
+
+	QueryFunc: func(k *Kero, start, end int64) ([]AggregatedMetric, error) {
+		return k.CustomEvents(botFilter, start, end)
+	},
+}
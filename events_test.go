@@ -0,0 +1,71 @@
+package kero
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCustomEvents(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()))
+	defer k.Close()
+
+	events := []struct {
+		metric string
+		labels MetricLabels
+	}{
+		{"signup", MetricLabels{"plan": "pro", VisitorIdLabel: "a"}},
+		{"signup", MetricLabels{"plan": "pro", VisitorIdLabel: "a"}},
+		{"signup", MetricLabels{"plan": "free", VisitorIdLabel: "b"}},
+		{"export", MetricLabels{"format": "csv", VisitorIdLabel: "a"}},
+		{"export", MetricLabels{"format": "csv", BrowserFormFactorLabel: FormFactorBot}},
+		{OutboundClickMetricName, MetricLabels{LinkUrlLabel: "https://github.com/", VisitorIdLabel: "c"}},
+		// not custom events
+		{HttpReqMetricName, MetricLabels{HttpPathLabel: "/"}},
+		{"web_vital_lcp", MetricLabels{HttpPathLabel: "/"}},
+	}
+	start := time.Now().Add(-time.Hour)
+	for i, event := range events {
+		k.trackAt(event.metric, event.labels, 1, start.Add(time.Duration(i)*time.Second))
+	}
+	k.Flush()
+
+	now := time.Now().Unix()
+	all, err := k.CustomEvents(botFilter, 0, now)
+	if err != nil || len(all) != 3 {
+		t.Fatal("expected 3 custom events, got", all, err)
+	}
+	if all[0].Label != "signup" || all[0].Value != 3 || all[0].Extra[VisitorsKey] != 2 {
+		t.Error("unexpected counts of signups", all[0])
+	}
+	if all[1].Label != "export" || all[1].Value != 1 || all[2].Label != OutboundClickMetricName {
+		t.Error("expected bots to be excluded and events with the same count sorted by name", all[1:])
+	}
+
+	byPlan, err := k.CountEventsByLabel("signup", "plan", nil, 0, now)
+	if err != nil || len(byPlan) != 2 || byPlan[0].Label != "pro" || byPlan[0].Value != 2 || byPlan[0].Extra[VisitorsKey] != 1 {
+		t.Error("unexpected signups by plan", byPlan, err)
+	}
+
+	if props, _ := k.EventProperties(OutboundClickMetricName, 0, now); len(props) != 0 {
+		t.Error("expected labels set by Kero to be excluded, got", props)
+	}
+
+	dash := Dashboard{}
+	query := url.Values{"from": {start.Format(time.RFC3339)}, "to": {time.Now().Format(time.RFC3339)}, "event": {"signup"}, "event_label": {"unknown"}}
+	if err := dash.LoadDataFromQuery(k, query); err != nil {
+		t.Fatal("failed to load dashboard", err)
+	}
+	if len(dash.CustomEvents.Data) != 3 || !strings.Contains(dash.CustomEvents.Link(dash.CustomEvents.Data[0]), "event=signup") {
+		t.Error("expected custom events with links to their breakdown", dash.CustomEvents.Data)
+	}
+	breakdown := dash.EventBreakdown
+	if breakdown == nil || breakdown.Label != "plan" || len(breakdown.Stat.Data) != 2 {
+		t.Fatal("expected signups to be broken down by the first label", breakdown)
+	}
+	if !slices.ContainsFunc(breakdown.Labels, func(o TimeframeOption) bool { return o.Active && strings.Contains(o.URL, "event_label=plan") }) {
+		t.Error("expected links to breakdowns by each label", breakdown.Labels)
+	}
+}
@@ -0,0 +1,82 @@
+package kero
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type ExportFormat string
+
+const (
+	ExportCSV    ExportFormat = "csv"    // Header with timestamp, name, all label names and value, followed by one row per event
+	ExportNDJSON ExportFormat = "ndjson" // One JSON encoded [Metric] per line
+)
+
+// ContentType returns the MIME type of the format.
+func (f ExportFormat) ContentType() string {
+	if f == ExportNDJSON {
+		return "application/x-ndjson"
+	}
+
+	return "text/csv;charset=utf-8"
+}
+
+// Export writes all matching events within the timeframe to w. Events are read from the database
+// while being written, without loading all of them into memory first. Unlike with [Kero.Query],
+// events are grouped by their labels and sorted by time only within the group.
+func (k *Kero) Export(w io.Writer, format ExportFormat, metric string, labelFilters MetricLabels, start int64, end int64) error {
+	switch format {
+	case ExportCSV:
+		return k.exportCSV(w, metric, labelFilters, start, end)
+	case ExportNDJSON:
+		enc := json.NewEncoder(w)
+		for m, err := range k.QueryIter(metric, labelFilters, start, end) {
+			if err != nil {
+				return err
+			}
+			if err := enc.Encode(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown export format: %s", format)
+	}
+}
+
+func (k *Kero) exportCSV(w io.Writer, metric string, labelFilters MetricLabels, start int64, end int64) error {
+	labelNames, err := k.LabelNames(metric, labelFilters, start, end)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	header := append([]string{"timestamp", "name"}, labelNames...)
+	if err := cw.Write(append(header, "value")); err != nil {
+		return err
+	}
+
+	row := make([]string, len(labelNames)+3)
+	for m, err := range k.QueryIter(metric, labelFilters, start, end) {
+		if err != nil {
+			return err
+		}
+
+		row[0] = strconv.FormatInt(m.Ts, 10)
+		row[1] = m.Name
+		for i, name := range labelNames {
+			row[i+2] = m.Labels[name]
+		}
+		row[len(row)-1] = strconv.FormatFloat(m.Value, 'f', -1, 64)
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,149 @@
+package kero
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExport(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()))
+	defer k.Close()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	trackPageViews(t, k, start, []testPageView{
+		{"a", "/", 0},
+		{"a", "/pricing", time.Minute},
+		{"b", "/", 2 * time.Minute},
+	})
+	k.trackAt("signup", MetricLabels{"plan": "pro"}, 1, start)
+	k.Flush()
+	end := time.Now().Unix()
+
+	var buf bytes.Buffer
+	if err := k.Export(&buf, ExportCSV, HttpReqMetricName, nil, start.Unix(), end); err != nil {
+		t.Fatal("failed to export CSV", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal("exported invalid CSV", err)
+	}
+	wantHeader := []string{"timestamp", "name", HttpPathLabel, VisitorIdLabel, "value"}
+	if strings.Join(records[0], ",") != strings.Join(wantHeader, ",") {
+		t.Error("expected header", wantHeader, "got", records[0])
+	}
+	if len(records) != 4 {
+		t.Fatal("expected 3 exported events, got", len(records)-1)
+	}
+	if records[1][1] != HttpReqMetricName || records[1][4] != "1" {
+		t.Error("unexpected row", records[1])
+	}
+
+	buf.Reset()
+	if err := k.Export(&buf, ExportNDJSON, "", MetricLabels{"plan": "pro"}, start.Unix(), end); err != nil {
+		t.Fatal("failed to export NDJSON", err)
+	}
+	lines := 0
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var m Metric
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			t.Fatal("exported invalid JSON", err)
+		}
+		if m.Name != "signup" || m.Ts != start.Unix() {
+			t.Error("unexpected event", m)
+		}
+		lines += 1
+	}
+	if lines != 1 {
+		t.Error("expected one exported event, got", lines)
+	}
+
+	if err := k.Export(&buf, ExportFormat("xml"), "", nil, start.Unix(), end); err == nil {
+		t.Error("should fail with unknown format")
+	}
+}
+
+func TestStatWriteCSV(t *testing.T) {
+	stat := DashboardStat{
+		UnitDisplayLabel: "Path",
+		CountLabel:       "Exits",
+		ExtraColumns:     []StatColumn{{Title: "Exit rate", Key: ExitRateKey}},
+		Data: []AggregatedMetric{
+			{Label: "/pricing", Value: 2, Extra: map[string]float64{ExitRateKey: 12.5}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := stat.WriteCSV(&buf); err != nil {
+		t.Fatal("failed to write CSV", err)
+	}
+	if want := "Path,Exits,Exit rate\n/pricing,2,12.5\n"; buf.String() != want {
+		t.Errorf("expected %q, got %q", want, buf.String())
+	}
+}
+
+func TestExportStat(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()), WithGoals(Goal{Name: "Signup", Metric: "signup"}))
+	defer k.Close()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	trackPageViews(t, k, start, []testPageView{
+		{"a", "/", 0},
+		{"a", "/pricing", time.Minute},
+		{"b", "/", 2 * time.Minute},
+	})
+	k.trackAt("signup", MetricLabels{VisitorIdLabel: "a", "plan": "pro"}, 1, start.Add(3*time.Minute))
+	k.Flush()
+
+	dash := Dashboard{Rows: [][]DashboardStat{{{
+		Title:            "Paths",
+		UnitDisplayLabel: "Path",
+		CountLabel:       "Views",
+		QueryMetric:      HttpReqMetricName,
+		QueryLabel:       HttpPathLabel,
+	}}}}
+	query := url.Values{"from": {start.Format(time.RFC3339)}, "to": {time.Now().Format(time.RFC3339)}, "event": {"signup"}, "event_label": {"plan"}}
+	// loading the dashboard again shouldn't change the links
+	dash.LoadDataFromQuery(k, query)
+	dash.LoadDataFromQuery(k, query)
+
+	stats := []DashboardStat{dash.Rows[len(dash.Rows)-1][0], dash.Rows[0][0], dash.CustomEvents, dash.EventBreakdown.Stat}
+	for _, stat := range stats {
+		if len(stat.ExportURL) == 0 {
+			t.Error("expected export link of", stat.Title)
+			continue
+		}
+
+		exportQuery, _ := url.ParseQuery(strings.TrimPrefix(stat.ExportURL, "?"))
+		exportDash := dash
+		exported, err := exportDash.ExportStat(k, exportQuery)
+		if err != nil {
+			t.Error("failed to export", stat.Title, err)
+			continue
+		}
+		if exported.Title != stat.Title || len(exported.Data) != len(stat.Data) {
+			t.Error("expected", stat.Title, "with", stat.Data, "got", exported.Title, exported.Data)
+		}
+	}
+
+	query.Set(DashboardExportParam, "top-planets")
+	if _, err := dash.ExportStat(k, query); !errors.Is(err, ErrStatNotFound) {
+		t.Error("expected unknown stat not to be found, got", err)
+	}
+
+	w := httptest.NewRecorder()
+	query.Set(DashboardExportParam, "paths")
+	dash.ServeStatCSV(k, w, query)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "Path,Views\n") || !strings.Contains(w.Header().Get("Content-Disposition"), "paths-") {
+		t.Error("expected paths as CSV, got", w.Code, w.Header(), w.Body.String())
+	}
+}
@@ -0,0 +1,123 @@
+package kero
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// FunnelStep matches events which count as reaching a step of the funnel, ie. a visit to a page:
+//
+//	kero.FunnelStep{Metric: kero.HttpReqMetricName, Filters: kero.MetricLabels{kero.HttpPathLabel: "/pricing"}}
+//
+// or a custom event:
+//
+//	kero.FunnelStep{Metric: "signup_completed"}
+type FunnelStep struct {
+	Title   string // Defaults to the value of the path filter or the metric name
+	Metric  string
+	Filters MetricLabels
+	Within  time.Duration // Optional, maximum time between reaching the previous step and this one
+}
+
+// FunnelStepResult is the number of visitors who reached the step after going through all of the previous steps.
+type FunnelStepResult struct {
+	Title      string  `json:"title"`
+	Visitors   int     `json:"visitors"`
+	Conversion float64 `json:"conversion"` // Percentage of visitors who entered the funnel and reached this step
+	DropOff    float64 `json:"drop_off"`   // Percentage of visitors from the previous step who didn't reach this step
+}
+
+func (s *FunnelStep) displayTitle() string {
+	if len(s.Title) > 0 {
+		return s.Title
+	}
+
+	if path, ok := s.Filters[HttpPathLabel]; ok && s.Metric == HttpReqMetricName {
+		return path
+	}
+
+	return s.Metric
+}
+
+// Funnel counts how many distinct visitors reached each of the steps, in order, within the timeframe.
+// Visitor reaches a step only if the matching event happened after reaching the previous step,
+// and, if the step's Within is set, not later than Within after it.
+func (k *Kero) Funnel(steps []FunnelStep, start int64, end int64) ([]FunnelStepResult, error) {
+	if len(steps) == 0 {
+		return []FunnelStepResult{}, errors.New("funnel has no steps")
+	}
+
+	results := make([]FunnelStepResult, len(steps))
+	// times (in ms) at which each visitor reached the previous step, sorted from oldest
+	var reached map[string][]int64
+
+	for i, step := range steps {
+		events, err := k.eventTimesByVisitor(step.Metric, step.Filters, start, end)
+		if err != nil {
+			return []FunnelStepResult{}, err
+		}
+
+		if i > 0 {
+			events = reachedAfter(reached, events, step.Within.Milliseconds())
+		}
+		reached = events
+
+		results[i].Title = step.displayTitle()
+		results[i].Visitors = len(reached)
+		if entered := results[0].Visitors; entered > 0 {
+			results[i].Conversion = float64(results[i].Visitors) / float64(entered) * 100
+		}
+		if i > 0 && results[i-1].Visitors > 0 {
+			results[i].DropOff = float64(results[i-1].Visitors-results[i].Visitors) / float64(results[i-1].Visitors) * 100
+		}
+	}
+
+	return results, nil
+}
+
+// eventTimesByVisitor returns times (in ms) of matching events for each visitor, sorted from oldest.
+func (k *Kero) eventTimesByVisitor(metric string, labelFilters MetricLabels, start int64, end int64) (map[string][]int64, error) {
+	metrics, err := k.Query(metric, labelFilters, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	times := make(map[string][]int64)
+	// metrics are sorted by newest first
+	for i := len(metrics) - 1; i >= 0; i-- {
+		if visitorId, ok := metrics[i].Labels[VisitorIdLabel]; ok {
+			times[visitorId] = append(times[visitorId], metrics[i].tsMillis)
+		}
+	}
+
+	return times, nil
+}
+
+// reachedAfter keeps only events which happened after the visitor reached the previous step.
+// If within is positive, events have to happen at most within ms after the previous step.
+func reachedAfter(previous map[string][]int64, events map[string][]int64, within int64) map[string][]int64 {
+	reached := make(map[string][]int64)
+
+	for visitorId, times := range events {
+		prevTimes, ok := previous[visitorId]
+		if !ok {
+			continue
+		}
+
+		for _, t := range times {
+			// latest time at which the previous step was reached before t
+			idx := sort.Search(len(prevTimes), func(i int) bool { return prevTimes[i] > t }) - 1
+			if idx < 0 {
+				continue
+			}
+			if within > 0 && t-prevTimes[idx] > within {
+				continue
+			}
+
+			reached[visitorId] = append(reached[visitorId], t)
+		}
+	}
+
+	return reached
+}
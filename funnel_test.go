@@ -0,0 +1,65 @@
+package kero
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFunnel(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()))
+	defer k.Close()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	trackPageViews(t, k, start, []testPageView{
+		{"a", "/pricing", 0},
+		{"a", "/signup", time.Minute},
+		{"b", "/pricing", time.Minute},
+		// visited the steps in the wrong order
+		{"c", "/signup", time.Minute},
+		{"c", "/pricing", 2 * time.Minute},
+		{"d", "/pricing", 2 * time.Minute},
+		{"d", "/signup", 20 * time.Minute},
+	})
+	for _, visitor := range []string{"a", "d"} {
+		labels := MetricLabels{VisitorIdLabel: visitor}
+		if err := k.trackAt("signup_completed", labels, 1, start.Add(25*time.Minute)); err != nil {
+			t.Fatal("failed to track signup", err)
+		}
+	}
+	k.Flush()
+
+	steps := []FunnelStep{
+		{Metric: HttpReqMetricName, Filters: MetricLabels{HttpPathLabel: "/pricing"}},
+		{Metric: HttpReqMetricName, Filters: MetricLabels{HttpPathLabel: "/signup"}},
+		{Title: "Signed up", Metric: "signup_completed"},
+	}
+	results, err := k.Funnel(steps, start.Unix(), time.Now().Unix())
+	if err != nil {
+		t.Fatal("failed to load funnel", err)
+	}
+
+	wants := []FunnelStepResult{
+		{Title: "/pricing", Visitors: 4, Conversion: 100},
+		{Title: "/signup", Visitors: 2, Conversion: 50, DropOff: 50},
+		{Title: "Signed up", Visitors: 2, Conversion: 50, DropOff: 0},
+	}
+	for i, want := range wants {
+		if results[i] != want {
+			t.Error("step", i, "expected", want, "got", results[i])
+		}
+	}
+
+	// "d" took longer than 10 minutes to get to the signup page
+	steps[1].Within = 10 * time.Minute
+	results, err = k.Funnel(steps, start.Unix(), time.Now().Unix())
+	if err != nil {
+		t.Fatal("failed to load funnel", err)
+	}
+	if results[1].Visitors != 1 || results[2].Visitors != 1 {
+		t.Error("expected only one visitor to reach the signup within the window, got", results)
+	}
+
+	if _, err := k.Funnel(nil, start.Unix(), time.Now().Unix()); err == nil {
+		t.Error("funnel without steps should fail")
+	}
+}
@@ -1,11 +1,11 @@
 module github.com/josip/kero
 
-go 1.21
+go 1.23
 
 require (
 	github.com/gin-gonic/gin v1.9.1
+	github.com/go-kit/log v0.2.1
 	github.com/gofiber/fiber/v2 v2.52.4
-	github.com/josip/timewarp v1.0.0
 	github.com/mileusna/useragent v1.3.5
 	github.com/oschwald/geoip2-golang v1.11.0
 	github.com/prometheus/prometheus v0.53.0
@@ -28,7 +28,6 @@ require (
 	github.com/dennwc/varint v1.0.0 // indirect
 	github.com/gabriel-vasile/mimetype v1.4.2 // indirect
 	github.com/gin-contrib/sse v0.1.0 // indirect
-	github.com/go-kit/log v0.2.1 // indirect
 	github.com/go-logfmt/logfmt v0.6.0 // indirect
 	github.com/go-logr/logr v1.4.1 // indirect
 	github.com/go-playground/locales v0.14.1 // indirect
@@ -0,0 +1,200 @@
+package kero
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+)
+
+// GoalCompletionsKey is the key in [AggregatedMetric.Extra] with the total number of goal completions.
+const GoalCompletionsKey = "completions"
+
+// ConversionRateKey is the key in [AggregatedMetric.Extra] with the percentage of visitors who completed the goal.
+const ConversionRateKey = "conversion_rate"
+
+// GoalSourceNone is the label of visitors without a referrer or UTM source in goal breakdowns.
+const GoalSourceNone = "(none)"
+
+// Goal marks events as conversions, ie. a custom metric:
+//
+//	kero.Goal{Name: "Newsletter", Metric: "newsletter_subscribed"}
+//
+// or visits to pages:
+//
+//	kero.Goal{Name: "Purchase", PathPattern: "/checkout/*/done"}
+type Goal struct {
+	Name        string
+	Metric      string // Defaults to `http_req` if only the PathPattern is set
+	PathPattern string // Optional, pattern of the path as described in [path.Match]
+}
+
+// GoalStats summarizes completions of a goal within a timeframe.
+type GoalStats struct {
+	Name           string  `json:"name"`
+	Visitors       int     `json:"visitors"`        // Unique visitors who completed the goal
+	Completions    int     `json:"completions"`     // Total number of completions
+	ConversionRate float64 `json:"conversion_rate"` // Percentage of all visitors who completed the goal
+}
+
+// WithGoals sets which events should be counted as goals. Goal names must be unique.
+func WithGoals(goals ...Goal) KeroOption {
+	return func(k *Kero) error {
+		goals := append([]Goal(nil), goals...)
+		names := make(map[string]bool)
+		for i, goal := range goals {
+			if len(goal.Name) == 0 {
+				return errors.New("goal name is required")
+			}
+			if names[goal.Name] {
+				return fmt.Errorf("duplicate goal: %s", goal.Name)
+			}
+			names[goal.Name] = true
+
+			if len(goal.Metric) == 0 && len(goal.PathPattern) == 0 {
+				return fmt.Errorf("goal %s requires a metric or a path pattern", goal.Name)
+			}
+			if _, err := path.Match(goal.PathPattern, ""); err != nil {
+				return fmt.Errorf("invalid path pattern of goal %s: %w", goal.Name, err)
+			}
+			if len(goal.Metric) == 0 {
+				goals[i].Metric = HttpReqMetricName
+			}
+		}
+
+		k.goals = goals
+		return nil
+	}
+}
+
+// Goals returns the configured goals.
+func (k *Kero) Goals() []Goal {
+	return k.goals
+}
+
+func (k *Kero) findGoal(name string) (Goal, bool) {
+	for _, goal := range k.goals {
+		if goal.Name == name {
+			return goal, true
+		}
+	}
+
+	return Goal{}, false
+}
+
+// goalCompletions returns events, excluding ones made by bots, which completed the goal.
+func (k *Kero) goalCompletions(goal Goal, start int64, end int64) ([]Metric, error) {
+	metrics, err := k.Query(goal.Metric, botFilter, start, end)
+	if err != nil || len(goal.PathPattern) == 0 {
+		return metrics, err
+	}
+
+	completions := []Metric{}
+	for _, metric := range metrics {
+		if matched, _ := path.Match(goal.PathPattern, metric.Labels[HttpPathLabel]); matched {
+			completions = append(completions, metric)
+		}
+	}
+
+	return completions, nil
+}
+
+// GoalStats counts completions of all configured goals within the timeframe.
+// Conversion rate is calculated against all unique visitors, excluding bots.
+func (k *Kero) GoalStats(start int64, end int64) ([]GoalStats, error) {
+	visitors, err := k.CountVisitors(HttpReqMetricName, botFilter, start, end)
+	if err != nil {
+		return []GoalStats{}, err
+	}
+
+	allStats := make([]GoalStats, len(k.goals))
+	for i, goal := range k.goals {
+		completions, err := k.goalCompletions(goal, start, end)
+		if err != nil {
+			return []GoalStats{}, err
+		}
+
+		visitorIds := make(map[string]bool)
+		for _, metric := range completions {
+			if id, ok := metric.Labels[VisitorIdLabel]; ok {
+				visitorIds[id] = true
+			}
+		}
+
+		allStats[i] = GoalStats{
+			Name:        goal.Name,
+			Visitors:    len(visitorIds),
+			Completions: len(completions),
+		}
+		if visitors > 0 {
+			allStats[i].ConversionRate = float64(len(visitorIds)) / float64(visitors) * 100
+		}
+	}
+
+	return allStats, nil
+}
+
+// GoalBreakdown counts unique visitors who completed the goal, grouped by the value of the label, ie. [ReferrerDomainLabel] or [UTMSourceLabel].
+// Value is taken from the first page view of the visitor within the timeframe, so conversions are attributed
+// to the source which brought the visitor to the site. Visitors without the label are grouped under [GoalSourceNone].
+// Results are sorted by highest value first.
+func (k *Kero) GoalBreakdown(name string, label string, start int64, end int64) ([]AggregatedMetric, error) {
+	goal, ok := k.findGoal(name)
+	if !ok {
+		return []AggregatedMetric{}, fmt.Errorf("unknown goal: %s", name)
+	}
+
+	completions, err := k.goalCompletions(goal, start, end)
+	if err != nil {
+		return []AggregatedMetric{}, err
+	}
+	if len(completions) == 0 {
+		return []AggregatedMetric{}, nil
+	}
+
+	pageViews, err := k.Query(HttpReqMetricName, botFilter, start, end)
+	if err != nil {
+		return []AggregatedMetric{}, err
+	}
+
+	// metrics are sorted by newest first, so the first page view overwrites the later ones
+	sources := make(map[string]string)
+	for _, metric := range pageViews {
+		if id, ok := metric.Labels[VisitorIdLabel]; ok {
+			sources[id] = metric.Labels[label]
+		}
+	}
+
+	counts := make(map[string]map[string]bool)
+	for _, metric := range completions {
+		id, ok := metric.Labels[VisitorIdLabel]
+		if !ok {
+			continue
+		}
+
+		source, seen := sources[id]
+		if !seen {
+			source = metric.Labels[label]
+		}
+		if len(source) == 0 {
+			source = GoalSourceNone
+		}
+
+		if _, exists := counts[source]; !exists {
+			counts[source] = make(map[string]bool)
+		}
+		counts[source][id] = true
+	}
+
+	allMetrics := []AggregatedMetric{}
+	for source, visitors := range counts {
+		allMetrics = append(allMetrics, AggregatedMetric{
+			Label: source,
+			Value: float64(len(visitors)),
+		})
+	}
+
+	sort.SliceStable(allMetrics, func(i, j int) bool { return allMetrics[i].Value > allMetrics[j].Value })
+
+	return allMetrics, nil
+}
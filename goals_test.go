@@ -0,0 +1,113 @@
+package kero
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGoals(t *testing.T) {
+	k, err := New(
+		WithDB(t.TempDir()),
+		WithGoals(
+			Goal{Name: "Newsletter", Metric: "newsletter_subscribed"},
+			Goal{Name: "Purchase", PathPattern: "/checkout/*/done"},
+		),
+	)
+	if err != nil {
+		t.Fatal("failed to create kero", err)
+	}
+	defer k.Close()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	views := []struct {
+		visitor  string
+		path     string
+		referrer string
+		source   string
+	}{
+		{"a", "/", "news.ycombinator.com", ""},
+		{"a", "/checkout/1/done", "", ""},
+		{"a", "/checkout/2/done", "", ""},
+		{"b", "/", "", "newsletter"},
+		{"b", "/checkout/3/done", "", ""},
+		{"c", "/", "", ""},
+		{"d", "/checkout/4", "", ""},
+	}
+	for i, view := range views {
+		labels := MetricLabels{
+			VisitorIdLabel:      view.visitor,
+			HttpPathLabel:       view.path,
+			ReferrerDomainLabel: view.referrer,
+			UTMSourceLabel:      view.source,
+		}
+		if err := k.trackAt(HttpReqMetricName, labels, 1, start.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal("failed to track page view", err)
+		}
+	}
+	if err := k.trackAt("newsletter_subscribed", MetricLabels{VisitorIdLabel: "c"}, 1, start.Add(10*time.Minute)); err != nil {
+		t.Fatal("failed to track event", err)
+	}
+	k.Flush()
+
+	end := time.Now().Unix()
+	stats, err := k.GoalStats(start.Unix(), end)
+	if err != nil {
+		t.Fatal("failed to load goal stats", err)
+	}
+	wants := []GoalStats{
+		{Name: "Newsletter", Visitors: 1, Completions: 1, ConversionRate: 25},
+		{Name: "Purchase", Visitors: 2, Completions: 3, ConversionRate: 50},
+	}
+	for i, want := range wants {
+		if stats[i] != want {
+			t.Error("expected", want, "got", stats[i])
+		}
+	}
+
+	byReferrer, err := k.GoalBreakdown("Purchase", ReferrerDomainLabel, start.Unix(), end)
+	if err != nil {
+		t.Fatal("failed to load goal breakdown", err)
+	}
+	if len(byReferrer) != 2 {
+		t.Fatal("expected purchases from 2 referrers, got", byReferrer)
+	}
+	for _, row := range byReferrer {
+		if (row.Label != "news.ycombinator.com" && row.Label != GoalSourceNone) || row.Value != 1 {
+			t.Error("unexpected referrer", row)
+		}
+	}
+
+	bySource, _ := k.GoalBreakdown("Purchase", UTMSourceLabel, start.Unix(), end)
+	if len(bySource) != 2 {
+		t.Error("expected purchases from 2 sources, got", bySource)
+	}
+
+	if _, err := k.GoalBreakdown("Signup", UTMSourceLabel, start.Unix(), end); err == nil {
+		t.Error("should fail for unknown goals")
+	}
+	dash := DefaultDashboard
+	dash.LoadData(k, "t")
+	rows := len(dash.Rows)
+	if want := len(DefaultDashboard.Rows) + 3; rows != want {
+		t.Error("expected", want, "rows with goals, got", rows)
+	}
+	dash.LoadData(k, "t")
+	if len(dash.Rows) != rows || dash.Rows[0][0].Title != "Goals" || dash.Rows[3][0].Title != DefaultDashboard.Rows[0][0].Title {
+		t.Error("expected goal rows to be replaced when reloading, got", len(dash.Rows), "rows")
+	}
+}
+
+func TestInvalidGoals(t *testing.T) {
+	invalidGoals := [][]Goal{
+		{{Metric: "signup"}},
+		{{Name: "Signup"}},
+		{{Name: "Signup", Metric: "signup"}, {Name: "Signup", Metric: "signup_completed"}},
+		{{Name: "Signup", PathPattern: "/signup/["}},
+	}
+
+	for _, goals := range invalidGoals {
+		if _, err := New(WithDB(t.TempDir()), WithGoals(goals...)); err == nil {
+			t.Error("expected goals to be rejected", goals)
+		}
+	}
+}
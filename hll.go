@@ -0,0 +1,176 @@
+package kero
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// hllPrecision of 14 bits gives 16384 registers with a standard error of about 0.8%.
+const hllPrecision = 14
+const hllRegisters = 1 << hllPrecision
+
+// sketches are kept sparse until the map of registers would use more memory than the dense array
+const hllSparseMax = hllRegisters / 16
+
+const hllFormatVersion = 1
+
+// hyperLogLog estimates the number of distinct values added to it using a fixed amount of memory.
+// Sketches of different time periods or groups can be merged to estimate the number of distinct values in their union.
+type hyperLogLog struct {
+	sparse    map[uint16]uint8 // used until it grows beyond hllSparseMax
+	registers []uint8          // dense registers, nil while sparse
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{sparse: make(map[uint16]uint8)}
+}
+
+// hllHash hashes the value using FNV-1a, mixed with murmur3's finalizer as FNV doesn't spread similar values well enough.
+// It's stable between processes, unlike hash/maphash, as sketches are persisted.
+func hllHash(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	x := h.Sum64()
+
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func (h *hyperLogLog) Add(value string) {
+	h.AddHash(hllHash(value))
+}
+
+func (h *hyperLogLog) AddHash(x uint64) {
+	idx := uint16(x >> (64 - hllPrecision))
+	// the guard bit limits rank to 64-hllPrecision+1 when all remaining bits are zero
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	h.set(idx, rank)
+}
+
+func (h *hyperLogLog) set(idx uint16, rank uint8) {
+	if h.registers != nil {
+		h.registers[idx] = max(h.registers[idx], rank)
+		return
+	}
+
+	if rank > h.sparse[idx] {
+		h.sparse[idx] = rank
+		if len(h.sparse) > hllSparseMax {
+			h.toDense()
+		}
+	}
+}
+
+func (h *hyperLogLog) toDense() {
+	h.registers = make([]uint8, hllRegisters)
+	for idx, rank := range h.sparse {
+		h.registers[idx] = rank
+	}
+	h.sparse = nil
+}
+
+// Merge adds all values of the other sketch to h.
+func (h *hyperLogLog) Merge(other *hyperLogLog) {
+	if other.registers == nil {
+		for idx, rank := range other.sparse {
+			h.set(idx, rank)
+		}
+		return
+	}
+
+	if h.registers == nil {
+		h.toDense()
+	}
+	for idx, rank := range other.registers {
+		h.registers[idx] = max(h.registers[idx], rank)
+	}
+}
+
+// Estimate returns the estimated number of distinct values.
+func (h *hyperLogLog) Estimate() uint64 {
+	m := float64(hllRegisters)
+	if h.registers == nil {
+		// sparse sketches have few registers set, where linear counting is more accurate
+		if len(h.sparse) == 0 {
+			return 0
+		}
+		return uint64(math.Round(m * math.Log(m/(m-float64(len(h.sparse))))))
+	}
+
+	sum := 0.0
+	zeros := 0
+	for _, rank := range h.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(math.Round(estimate))
+}
+
+// MarshalBinary encodes the sketch as the format version and either the sorted sparse registers, or all dense registers.
+func (h *hyperLogLog) MarshalBinary() ([]byte, error) {
+	if h.registers != nil {
+		data := make([]byte, 0, 2+hllRegisters)
+		data = append(data, hllFormatVersion, 'd')
+		return append(data, h.registers...), nil
+	}
+
+	idxs := make([]uint16, 0, len(h.sparse))
+	for idx := range h.sparse {
+		idxs = append(idxs, idx)
+	}
+	slices.Sort(idxs)
+
+	data := make([]byte, 0, 2+len(idxs)*3)
+	data = append(data, hllFormatVersion, 's')
+	for _, idx := range idxs {
+		data = binary.BigEndian.AppendUint16(data, idx)
+		data = append(data, h.sparse[idx])
+	}
+	return data, nil
+}
+
+func (h *hyperLogLog) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || data[0] != hllFormatVersion {
+		return errors.New("unsupported sketch format")
+	}
+
+	switch data[1] {
+	case 'd':
+		if len(data) != 2+hllRegisters {
+			return errors.New("invalid dense sketch")
+		}
+		h.sparse = nil
+		h.registers = slices.Clone(data[2:])
+	case 's':
+		entries := data[2:]
+		if len(entries)%3 != 0 || len(entries)/3 > hllSparseMax {
+			return errors.New("invalid sparse sketch")
+		}
+		h.registers = nil
+		h.sparse = make(map[uint16]uint8, len(entries)/3)
+		for i := 0; i < len(entries); i += 3 {
+			h.sparse[binary.BigEndian.Uint16(entries[i:])] = entries[i+2]
+		}
+	default:
+		return errors.New("invalid sketch type")
+	}
+
+	return nil
+}
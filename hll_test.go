@@ -0,0 +1,75 @@
+package kero
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000, 5000, 100_000, 1_000_000} {
+		h := newHyperLogLog()
+		for i := range n {
+			h.Add("visitor-" + strconv.Itoa(i))
+			// duplicates don't change the estimate
+			h.Add("visitor-" + strconv.Itoa(i))
+		}
+
+		estimate := float64(h.Estimate())
+		if relErr := math.Abs(estimate-float64(n)) / max(float64(n), 1); relErr > 0.03 {
+			t.Error("estimate of", n, "is off by", relErr*100, "%:", estimate)
+		}
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	a, b, c := newHyperLogLog(), newHyperLogLog(), newHyperLogLog()
+	for i := range 20_000 {
+		a.Add(strconv.Itoa(i))
+	}
+	for i := 10_000; i < 10_500; i++ {
+		b.Add(strconv.Itoa(i))
+		c.Add(strconv.Itoa(i + 20_000))
+	}
+
+	// sparse into sparse
+	b.Merge(c)
+	if estimate := b.Estimate(); estimate < 990 || estimate > 1010 {
+		t.Error("expected about 1000 visitors, got", estimate)
+	}
+	// sparse into dense
+	a.Merge(b)
+	if estimate := a.Estimate(); estimate < 20_000 || estimate > 21_000 {
+		t.Error("expected about 20500 visitors, got", estimate)
+	}
+	// dense into sparse
+	c.Merge(a)
+	if c.Estimate() != a.Estimate() {
+		t.Error("expected merged sketches to be equal", c.Estimate(), a.Estimate())
+	}
+}
+
+func TestHyperLogLogMarshal(t *testing.T) {
+	for _, n := range []int{10, 10_000} {
+		h := newHyperLogLog()
+		for i := range n {
+			h.Add(strconv.Itoa(i))
+		}
+
+		data, err := h.MarshalBinary()
+		if err != nil {
+			t.Fatal("failed to marshal sketch", err)
+		}
+		decoded := &hyperLogLog{}
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatal("failed to unmarshal sketch", err)
+		}
+		if decoded.Estimate() != h.Estimate() {
+			t.Error("expected", h.Estimate(), "got", decoded.Estimate())
+		}
+	}
+
+	if err := (&hyperLogLog{}).UnmarshalBinary([]byte{hllFormatVersion, 's', 1}); err == nil {
+		t.Error("should fail with truncated sketch")
+	}
+}
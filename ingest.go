@@ -0,0 +1,197 @@
+package kero
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	plabels "github.com/prometheus/prometheus/model/labels"
+)
+
+// IngestFullPolicy defines what happens to newly tracked events when the ingestion queue is full.
+type IngestFullPolicy int
+
+const (
+	IngestBlock IngestFullPolicy = iota // Tracking blocks until there's space in the queue
+	IngestDrop                          // Event is discarded and counted in [Kero.DroppedEvents]
+)
+
+const defaultIngestBufferSize = 4096
+const defaultIngestBatchSize = 512
+const defaultIngestFlushInterval = time.Second
+
+var ErrIngestQueueFull = errors.New("kero ingestion queue is full, event dropped")
+var ErrClosed = errors.New("kero is closed")
+
+type trackedEvent struct {
+	labels plabels.Labels
+	ts     int64
+	value  float64
+}
+
+// WithIngestBuffer sets how many tracked events can be waiting to be written to the database
+// and what should happen once the buffer is full. Defaults to 4096 events and IngestBlock.
+func WithIngestBuffer(size int, policy IngestFullPolicy) KeroOption {
+	return func(k *Kero) error {
+		if size < 1 {
+			return errors.New("ingest buffer size must be at least 1")
+		}
+		k.ingestBufferSize = size
+		k.ingestFullPolicy = policy
+		return nil
+	}
+}
+
+// WithIngestBatch sets how many events are written to the database at once and how often
+// are pending events written if the batch doesn't fill up in the meantime. Defaults to 512 events and 1s.
+func WithIngestBatch(size int, flushInterval time.Duration) KeroOption {
+	return func(k *Kero) error {
+		if size < 1 {
+			return errors.New("ingest batch size must be at least 1")
+		}
+		if flushInterval <= 0 {
+			return errors.New("ingest flush interval must be positive")
+		}
+		k.ingestBatchSize = size
+		k.ingestFlushInterval = flushInterval
+		return nil
+	}
+}
+
+// DroppedEvents returns the number of events discarded because the ingestion queue was full.
+func (k *Kero) DroppedEvents() uint64 {
+	return k.droppedEvents.Load()
+}
+
+// Flush blocks until all events tracked so far are written to the database.
+func (k *Kero) Flush() error {
+	k.closeLock.RLock()
+	defer k.closeLock.RUnlock()
+
+	if k.closed {
+		return ErrClosed
+	}
+
+	done := make(chan struct{})
+	k.ingestFlushes <- done
+	<-done
+
+	return nil
+}
+
+func (k *Kero) startIngestion() {
+	if k.ingestBufferSize == 0 {
+		k.ingestBufferSize = defaultIngestBufferSize
+	}
+	if k.ingestBatchSize == 0 {
+		k.ingestBatchSize = defaultIngestBatchSize
+	}
+	if k.ingestFlushInterval == 0 {
+		k.ingestFlushInterval = defaultIngestFlushInterval
+	}
+
+	k.ingestQueue = make(chan trackedEvent, k.ingestBufferSize)
+	k.ingestFlushes = make(chan chan struct{})
+	k.ingestDone = make(chan struct{})
+
+	go k.runIngestion()
+}
+
+// stopIngestion writes all queued events to the database and stops the background worker.
+func (k *Kero) stopIngestion() {
+	k.closeLock.Lock()
+	defer k.closeLock.Unlock()
+
+	if k.closed {
+		return
+	}
+
+	k.closed = true
+	close(k.ingestQueue)
+	<-k.ingestDone
+}
+
+func (k *Kero) enqueue(event trackedEvent) error {
+	k.closeLock.RLock()
+	defer k.closeLock.RUnlock()
+
+	if k.closed {
+		return ErrClosed
+	}
+
+	if k.ingestFullPolicy == IngestDrop {
+		select {
+		case k.ingestQueue <- event:
+			return nil
+		default:
+			k.droppedEvents.Add(1)
+			return ErrIngestQueueFull
+		}
+	}
+
+	k.ingestQueue <- event
+	return nil
+}
+
+func (k *Kero) runIngestion() {
+	defer close(k.ingestDone)
+
+	ticker := time.NewTicker(k.ingestFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]trackedEvent, 0, k.ingestBatchSize)
+	for {
+		select {
+		case event, ok := <-k.ingestQueue:
+			if !ok {
+				k.commitEvents(batch)
+				return
+			}
+
+			batch = append(batch, event)
+			if len(batch) >= k.ingestBatchSize {
+				batch = k.commitEvents(batch)
+			}
+		case <-ticker.C:
+			batch = k.commitEvents(batch)
+		case done := <-k.ingestFlushes:
+			for n := len(k.ingestQueue); n > 0; n-- {
+				batch = append(batch, <-k.ingestQueue)
+			}
+			batch = k.commitEvents(batch)
+			close(done)
+		}
+	}
+}
+
+// commitEvents writes the batch using a single appender and returns the emptied batch.
+func (k *Kero) commitEvents(batch []trackedEvent) []trackedEvent {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	// events tracked concurrently can be enqueued slightly out of order
+	sort.SliceStable(batch, func(i, j int) bool { return batch[i].ts < batch[j].ts })
+
+	app := k.db.Appender(context.Background())
+	failed := 0
+	var lastErr error
+	for _, event := range batch {
+		if _, err := app.Append(0, event.labels, event.ts, event.value); err != nil {
+			failed += 1
+			lastErr = err
+		}
+	}
+
+	if failed > 0 {
+		fmt.Println("[kero] failed to append", failed, "of", len(batch), "events:", lastErr)
+	}
+
+	if err := app.Commit(); err != nil {
+		fmt.Println("[kero] failed to commit", len(batch), "events:", err)
+	}
+
+	return batch[:0]
+}
@@ -0,0 +1,82 @@
+package kero
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCloseDrainsIngestQueue(t *testing.T) {
+	dbPath := t.TempDir()
+	k, err := New(WithDB(dbPath), WithIngestBatch(1000, time.Hour))
+	if err != nil {
+		t.Fatal("failed to create kero", err)
+	}
+
+	events := 10
+	for i := 0; i < events; i++ {
+		if err := k.TrackOne("test_event", MetricLabels{"n": strconv.Itoa(i)}); err != nil {
+			t.Fatal("failed to track event", err)
+		}
+	}
+
+	if err := k.Close(); err != nil {
+		t.Fatal("failed to close kero", err)
+	}
+	if err := k.TrackOne("test_event", nil); !errors.Is(err, ErrClosed) {
+		t.Error("expected tracking after Close to fail, got", err)
+	}
+
+	k, err = New(WithDB(dbPath))
+	if err != nil {
+		t.Fatal("failed to reopen kero", err)
+	}
+	defer k.Close()
+
+	if count := k.Count("test_event", 0, time.Now().Unix()); count != events {
+		t.Error("expected", events, "events to be written on close, got", count)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()), WithIngestBatch(1000, time.Hour))
+	defer k.Close()
+
+	k.TrackOne("test_event", nil)
+	if count := k.Count("test_event", 0, time.Now().Unix()); count != 0 {
+		t.Error("expected event to be still queued, found", count)
+	}
+
+	k.Flush()
+	if count := k.Count("test_event", 0, time.Now().Unix()); count != 1 {
+		t.Error("expected event to be written after Flush, found", count)
+	}
+}
+
+func TestIngestDropPolicy(t *testing.T) {
+	// without a worker the queue is never drained
+	k := &Kero{
+		ingestQueue:      make(chan trackedEvent, 1),
+		ingestFullPolicy: IngestDrop,
+	}
+
+	if err := k.TrackOne("test_event", nil); err != nil {
+		t.Fatal("expected first event to be queued, got", err)
+	}
+	if err := k.TrackOne("test_event", nil); !errors.Is(err, ErrIngestQueueFull) {
+		t.Error("expected second event to be dropped, got", err)
+	}
+	if dropped := k.DroppedEvents(); dropped != 1 {
+		t.Error("expected 1 dropped event, got", dropped)
+	}
+}
+
+func TestInvalidIngestOptions(t *testing.T) {
+	if _, err := New(WithDB(t.TempDir()), WithIngestBuffer(0, IngestDrop)); err == nil {
+		t.Error("should fail with empty buffer")
+	}
+	if _, err := New(WithDB(t.TempDir()), WithIngestBatch(10, 0)); err == nil {
+		t.Error("should fail without flush interval")
+	}
+}
@@ -3,6 +3,7 @@ package kerotest
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,11 +12,14 @@ import (
 
 const DashPath = "/_kero_test"
 const HelloPath = "/hello/:id"
+const HelloPattern = "/hello/{id}"
 const WaitPath = "/wait"
 const WaitDuration = time.Duration(123 * time.Millisecond)
 const DashUsername = "admin"
 const DashPass = "pass"
 const PixelPath = "/px.gif"
+const BeaconPath = "/_k"
+const beaconPagePath = "/app/settings"
 const pixelReferrerPath = "/blog/hello-mars"
 const pixelReferrer = "http://localhost:1234" + pixelReferrerPath
 const PrefixToIgnore = "/hello"
@@ -62,6 +66,66 @@ var DashboardTests = []DashboardTest{
 		Authed:      true,
 		ExpectError: false,
 	},
+	{
+		Description: "load dashboard with a custom timeframe",
+		Path:        DashPath + "?from=2024-01-01&to=2024-01-31&compare=yoy",
+		Authed:      true,
+		ExpectError: false,
+	},
+	{
+		Description: "reject invalid timeframe",
+		Path:        DashPath + "?from=yesterday",
+		Authed:      true,
+		ExpectError: true,
+	},
+	{
+		Description: "load dashboard in another timezone",
+		Path:        DashPath + "?t=7d&tz=Asia/Tokyo",
+		Authed:      true,
+		ExpectError: false,
+	},
+	{
+		Description: "load dashboard with latency of a route",
+		Path:        DashPath + "?t=7d&route=GET%20/",
+		Authed:      true,
+		ExpectError: false,
+	},
+	{
+		Description: "reject unknown timezone",
+		Path:        DashPath + "?tz=Mars/Olympus_Mons",
+		Authed:      true,
+		ExpectError: true,
+	},
+	{
+		Description: "prevent unauthorized access to the API",
+		Path:        DashPath + "/api/count?metric=http_req",
+		Authed:      false,
+		ExpectError: true,
+	},
+	{
+		Description: "query the API",
+		Path:        DashPath + "/api/count?metric=http_req&filter=$http_path!=/&t=7d",
+		Authed:      true,
+		ExpectError: false,
+	},
+	{
+		Description: "export a stat",
+		Path:        DashPath + "?t=7d&compare=none&export=top-pages",
+		Authed:      true,
+		ExpectError: false,
+	},
+	{
+		Description: "reject export of an unknown stat",
+		Path:        DashPath + "?t=7d&export=top-planets",
+		Authed:      true,
+		ExpectError: true,
+	},
+	{
+		Description: "reject invalid API requests",
+		Path:        DashPath + "/api/count",
+		Authed:      true,
+		ExpectError: true,
+	},
 }
 
 type TrackingTest struct {
@@ -108,6 +172,7 @@ func ExpectRequestsTracked(t *testing.T, k *kero.Kero) {
 		}
 	}
 
+	k.Flush()
 	tracked := k.Count(kero.HttpReqMetricName, 0, time.Now().Unix())
 
 	if tracked != expected {
@@ -115,9 +180,74 @@ func ExpectRequestsTracked(t *testing.T, k *kero.Kero) {
 	}
 }
 
+// ExpectRouteTracked checks that all tracked requests to /hello/... were recorded with the route,
+// ie. HelloPath or HelloPattern depending on the router.
+func ExpectRouteTracked(t *testing.T, k *kero.Kero, route string) {
+	expected := 0
+	for _, req := range TrackingTests {
+		if req.ExpectToBeTracked && strings.HasPrefix(req.Path, "/hello/") {
+			expected += 1
+		}
+	}
+
+	k.Flush()
+	records, err := k.Query(kero.HttpReqMetricName, kero.MetricLabels{kero.HttpRouteLabel: route}, 0, time.Now().Unix())
+	if err != nil {
+		t.Fatal("failed to query kero:", err)
+	}
+
+	if len(records) != expected {
+		t.Error("expected", expected, "requests to be tracked with route", route, "got", len(records))
+	}
+
+	// there's no handler for /
+	records, err = k.Query(kero.HttpReqMetricName, kero.MetricLabels{kero.HttpPathLabel: "/"}, 0, time.Now().Unix())
+	if err != nil {
+		t.Fatal("failed to query kero:", err)
+	}
+	for _, record := range records {
+		if unmatched := record.Labels[kero.HttpRouteLabel]; len(unmatched) > 0 {
+			t.Error("expected request without a handler not to have a route, got", unmatched)
+		}
+	}
+}
+
+// ExpectStatusCodesTracked checks that requests to /hello/... responded with 200 and that the request to /,
+// which has no handler, responded with 404.
+func ExpectStatusCodesTracked(t *testing.T, k *kero.Kero) {
+	k.Flush()
+	now := time.Now().Unix()
+
+	hellos := 0
+	for _, req := range TrackingTests {
+		if req.ExpectToBeTracked && strings.HasPrefix(req.Path, "/hello/") {
+			hellos += 1
+		}
+	}
+
+	okCount := k.CountWithFilters(kero.HttpReqMetricName, kero.MetricLabels{
+		kero.HttpStatusCodeLabel:  "200",
+		kero.HttpStatusClassLabel: "2xx",
+		kero.HttpPathLabel + "!=": "/",
+	}, 0, now)
+	if okCount != hellos {
+		t.Error("expected", hellos, "requests to be tracked with status 200, got", okCount)
+	}
+
+	notFoundCount := k.CountWithFilters(kero.HttpReqMetricName, kero.MetricLabels{
+		kero.HttpStatusCodeLabel:  "404",
+		kero.HttpStatusClassLabel: "4xx",
+		kero.HttpPathLabel:        "/",
+	}, 0, now)
+	if notFoundCount != 1 {
+		t.Error("expected request to / to be tracked with status 404, got", notFoundCount)
+	}
+}
+
 func ExpectDurationTracked(t *testing.T, k *kero.Kero) {
 	wants := 1
 
+	k.Flush()
 	records, err := k.Query(kero.HttpReqDurationMetricName, kero.MetricLabels{}, 0, time.Now().Unix())
 	if err != nil {
 		t.Fatal("failed to query kero:", err)
@@ -130,6 +260,14 @@ func ExpectDurationTracked(t *testing.T, k *kero.Kero) {
 	if records[0].Value < float64(WaitDuration.Milliseconds()) {
 		t.Error("expected request to take at least 100ms, got", records[0].Value)
 	}
+
+	if route := records[0].Labels[kero.HttpRouteLabel]; route != WaitPath {
+		t.Error("expected duration to be tracked with route", WaitPath, "got", route)
+	}
+
+	if status := records[0].Labels[kero.HttpStatusCodeLabel]; status != "200" {
+		t.Error("expected duration to be tracked with status 200, got", status)
+	}
 }
 
 func PixelRequest() *http.Request {
@@ -139,6 +277,7 @@ func PixelRequest() *http.Request {
 }
 
 func ExpectPixelToTrack(t *testing.T, k *kero.Kero) {
+	k.Flush()
 	res, err := k.Query(
 		kero.HttpReqMetricName,
 		kero.MetricLabels{
@@ -173,12 +312,81 @@ func ExpectPixelToTrack(t *testing.T, k *kero.Kero) {
 	}
 }
 
+// BeaconRequests returns a page view, a custom event and an outbound click sent by the beacon scripts, followed by an invalid event.
+func BeaconRequests() []*http.Request {
+	events := []string{
+		`{"name":"pageview","url":"http://localhost:1234` + beaconPagePath + `?utm_source=newsletter","referrer":"http://localhost:1234/app"}`,
+		`{"name":"signup","url":"http://localhost:1234` + beaconPagePath + `","props":{"plan":"pro"}}`,
+		`{"name":"outbound_click","url":"http://localhost:1234` + beaconPagePath + `","props":{"url":"https://github.com/josip/kero?tab=readme"}}`,
+		`{"name":"http_req","url":"http://localhost:1234/"}`,
+	}
+
+	reqs := make([]*http.Request, len(events))
+	for i, event := range events {
+		reqs[i] = httptest.NewRequest("POST", BeaconPath, strings.NewReader(event))
+		reqs[i].Header.Set("Content-Type", "text/plain;charset=UTF-8")
+	}
+	return reqs
+}
+
+// BeaconScriptRequests request the beacon and links scripts.
+func BeaconScriptRequests() []*http.Request {
+	return []*http.Request{
+		httptest.NewRequest("GET", BeaconPath+kero.BeaconScriptPath, nil),
+		httptest.NewRequest("GET", BeaconPath+kero.BeaconLinksScriptPath, nil),
+	}
+}
+
+// ExpectBeaconStatusCodes checks responses to [BeaconRequests].
+func ExpectBeaconStatusCodes(t *testing.T, codes []int) {
+	wants := []int{http.StatusNoContent, http.StatusNoContent, http.StatusNoContent, http.StatusBadRequest}
+	for i, code := range codes {
+		if code != wants[i] {
+			t.Error("beacon request", i, "expected status", wants[i], "got", code)
+		}
+	}
+}
+
+func ExpectBeaconToTrack(t *testing.T, k *kero.Kero) {
+	k.Flush()
+	now := time.Now().Unix()
+
+	pageViews, err := k.Query(kero.HttpReqMetricName, nil, 0, now)
+	if err != nil {
+		t.Fatal("failed to query db", err)
+	}
+	if len(pageViews) != 1 {
+		t.Fatal("expected beacon to track a page view, got", pageViews)
+	}
+	labels := pageViews[0].Labels
+	if labels[kero.HttpPathLabel] != beaconPagePath || labels[kero.UTMSourceLabel] != "newsletter" || labels[kero.ReferrerLabel] != "http://localhost:1234/app" {
+		t.Error("expected page view with path, UTM source and referrer of the page, got", labels)
+	}
+
+	events, err := k.Query("signup", kero.MetricLabels{"plan": "pro"}, 0, now)
+	if err != nil {
+		t.Fatal("failed to query db", err)
+	}
+	if len(events) != 1 || events[0].Labels[kero.HttpPathLabel] != beaconPagePath {
+		t.Error("expected beacon to track the custom event, got", events)
+	}
+
+	clicks, err := k.Query(kero.OutboundClickMetricName, kero.MetricLabels{kero.LinkDomainLabel: "github.com"}, 0, now)
+	if err != nil {
+		t.Fatal("failed to query db", err)
+	}
+	if len(clicks) != 1 || clicks[0].Labels[kero.LinkUrlLabel] != "https://github.com/josip/kero" {
+		t.Error("expected beacon to track the outbound click, got", clicks)
+	}
+}
+
 func IgnoredHelloRequest() *http.Request {
 	req := httptest.NewRequest("GET", "/hello/mars", nil)
 	return req
 }
 
 func ExpectHelloIgnored(t *testing.T, k *kero.Kero) {
+	k.Flush()
 	tracked := k.Count(kero.HttpReqMetricName, 0, time.Now().Unix())
 	if tracked != 0 {
 		t.Fatal("expected request to ignore prefix not to be tracked")
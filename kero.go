@@ -2,7 +2,11 @@ package kero
 
 import (
 	"errors"
+	"fmt"
+	"net/netip"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/oschwald/geoip2-golang"
@@ -18,6 +22,7 @@ type Kero struct {
 	reverseLookupIP        bool
 	DashboardPath          string
 	PixelPath              string
+	BeaconPath             string
 	MeasureRequestDuration bool
 	IgnoreCommonPaths      bool
 	IgnoreBots             bool
@@ -29,6 +34,29 @@ type Kero struct {
 	IgnoredSuffixes []string
 	// user-agent values to be ignored. see file for default list.
 	IgnoredAgents []string
+
+	sessionTimeout      time.Duration
+	location            *time.Location
+	weekStart           time.Weekday
+	rollupRetention     time.Duration
+	rollupDimensions    []string
+	rollups             *rollupStore
+	approximateVisitors bool
+	goals               []Goal
+	beaconEvents        map[string]bool
+	visitorSalt         *visitorSalt
+	trustedProxies      []netip.Prefix
+	clientIpSource      ClientIpSource
+	ingestBufferSize    int
+	ingestBatchSize     int
+	ingestFlushInterval time.Duration
+	ingestFullPolicy    IngestFullPolicy
+	ingestQueue         chan trackedEvent
+	ingestFlushes       chan chan struct{}
+	ingestDone          chan struct{}
+	droppedEvents       atomic.Uint64
+	closeLock           sync.RWMutex
+	closed              bool
 }
 
 type MetricLabels map[string]string
@@ -36,9 +64,13 @@ type MetricLabels map[string]string
 const MetricName = labels.MetricName
 const HttpReqMetricName = "http_req"
 const HttpReqDurationMetricName = "http_req_dur"
+const OutboundClickMetricName = "outbound_click"
+const FileDownloadMetricName = "file_download"
 const HttpMethodLabel = "$http_method"
 const HttpPathLabel = "$http_path"
 const HttpRouteLabel = "$http_route"
+const HttpStatusCodeLabel = "$status_code"
+const HttpStatusClassLabel = "$status_class"
 const BrowserNameLabel = "$browser_name"
 const BrowserVersionLabel = "$browser_version"
 const BrowserDeviceLabel = "$browser_device"
@@ -61,6 +93,8 @@ const RegionLabel = "$region"
 const CityLabel = "$city"
 const IsBotLabel = "$is_bot"
 const VisitorIdLabel = "$visitor_id"
+const LinkUrlLabel = "$link_url"
+const LinkDomainLabel = "$link_domain"
 
 var defaultIgnoredPathPrefixes = []string{
 	"/.",
@@ -154,7 +188,7 @@ type KeroOption func(*Kero) error
 // New automatically creates a new Kero database on-disk if one doesn't exist already.
 // See WithXXX functions for option configuration.
 func New(options ...KeroOption) (*Kero, error) {
-	k := &Kero{}
+	k := &Kero{weekStart: time.Monday}
 
 	for _, option := range options {
 		if err := option(k); err != nil {
@@ -165,6 +199,14 @@ func New(options ...KeroOption) (*Kero, error) {
 	if len(k.dbPath) == 0 {
 		return nil, errors.New("missing Kero database path")
 	}
+	if err := prepareDBFormat(k.dbPath); err != nil {
+		return nil, err
+	}
+	if visitorSalt, err := loadVisitorSalt(k.dbPath); err != nil {
+		return nil, err
+	} else {
+		k.visitorSalt = visitorSalt
+	}
 	tsdbOpts := tsdb.DefaultOptions()
 	if k.dbRetentionDuration > 0 {
 		tsdbOpts.RetentionDuration = k.dbRetentionDuration
@@ -180,10 +222,27 @@ func New(options ...KeroOption) (*Kero, error) {
 		k.DashboardPath = "/_kero"
 	}
 
+	if k.sessionTimeout == 0 {
+		k.sessionTimeout = defaultSessionTimeout
+	}
+
+	if k.location == nil {
+		k.location = time.Local
+	}
+
 	k.IgnoredPrefixes = defaultIgnoredPathPrefixes
 	k.IgnoredSuffixes = defaultIgnoredPathSuffixes
 	k.IgnoredAgents = defaultIgnoredAgents
 
+	if k.rollupRetention > 0 {
+		if err := k.openRollups(); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	k.startIngestion()
+
 	return k, nil
 }
 
@@ -277,6 +336,39 @@ func WithRetention(duration time.Duration) KeroOption {
 	}
 }
 
+// WithRollups enables hourly and daily rollups of all metrics, kept for the retention duration in a separate database.
+// Rollups count events and sum their values, in total and per value of each of the dimensions, defaulting to [DefaultRollupDimensions].
+// Counts and aggregations by a single label, optionally excluding or selecting only bots, are then read from the rollups
+// for whole hours and days, with only the rest of the timeframe read from raw events. This way raw events can be
+// kept for a short time with [WithRetention], while long-term trends remain available.
+//
+// Rollups are read only by [Kero.Count], [Kero.CountWithFilters], [Kero.CountHistogram] and [Kero.AggregateDistinctByLabel]
+// (for count, sum and average), and with [WithApproximateVisitors] by visitor counts. Other queries, including
+// [Kero.AggregateDistinct] which groups by a calculated key, always read raw events and return no data for timeframes
+// older than the retention of raw events.
+//
+// Rollups are written in background for hours which ended at least 5 minutes ago. Events tracked with a timestamp
+// older than that are not included in the rollups.
+func WithRollups(retention time.Duration, dimensions ...string) KeroOption {
+	return func(k *Kero) error {
+		if retention <= 0 {
+			return errors.New("rollup retention must be positive")
+		}
+		if len(dimensions) == 0 {
+			dimensions = DefaultRollupDimensions
+		}
+		for _, dim := range dimensions {
+			if len(dim) == 0 || dim == labels.MetricName {
+				return fmt.Errorf("invalid rollup dimension %q", dim)
+			}
+		}
+
+		k.rollupRetention = retention
+		k.rollupDimensions = append([]string{}, dimensions...)
+		return nil
+	}
+}
+
 // WithPixelPath defines the route at which the pixel tracker will be available to external applications.
 // The pixel can be referenced from static websites or services not directly served by the Go server.
 // Requests referer header will be used as the path, with other headers and query parameters used unchanged.
@@ -291,7 +383,36 @@ func WithPixelPath(path string) KeroOption {
 	}
 }
 
+// WithTimezone sets the timezone in which days start, used for dashboard timeframes, histograms and chart labels.
+// Defaults to the local timezone of the server. Dashboard and API requests can override it using the `tz` param.
+func WithTimezone(loc *time.Location) KeroOption {
+	return func(k *Kero) error {
+		if loc == nil {
+			return errors.New("timezone must not be nil")
+		}
+		k.location = loc
+		return nil
+	}
+}
+
+// WithWeekStart sets the day on which weeks start in histograms. Defaults to Monday, as in ISO weeks.
+func WithWeekStart(day time.Weekday) KeroOption {
+	return func(k *Kero) error {
+		if day < time.Sunday || day > time.Saturday {
+			return errors.New("week start must be a day of the week")
+		}
+		k.weekStart = day
+		return nil
+	}
+}
+
+// Close writes all pending events to the database before closing it.
 func (k *Kero) Close() error {
+	k.stopIngestion()
+	if err := k.closeRollups(); err != nil {
+		k.db.Close()
+		return err
+	}
 	return k.db.Close()
 }
 
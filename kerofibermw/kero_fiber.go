@@ -2,22 +2,27 @@ package kerofibermw
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/josip/kero"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/basicauth"
 	"github.com/gofiber/fiber/v2/middleware/filesystem"
+	"github.com/gofiber/fiber/v2/utils"
 )
 
 func Mount(app *fiber.App, k *kero.Kero, auth basicauth.Config) error {
 	mountDashboard(app, k, auth)
 	mountPixel(app, k)
+	mountBeacon(app, k)
 	app.Use(requestTracker(k))
 
 	return nil
@@ -28,14 +33,23 @@ func requestTracker(k *kero.Kero) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		if k.ShouldTrackHttpRequest(c.Path()) {
 			trackedHttpReq := trackedHttpReqFromCtx(c)
+			trackerRoute := c.Route()
+
+			start := time.Now()
+			err := c.Next()
+			duration := time.Since(start)
+
+			// Fiber resolves the route while going through the handler chain
+			if route := c.Route(); route != trackerRoute {
+				trackedHttpReq.Route = utils.CopyString(route.Path)
+			}
+			trackedHttpReq.StatusCode = statusCode(c, err)
 			k.TrackHttpRequest(trackedHttpReq)
 			if k.MeasureRequestDuration {
-				var err error
-				k.MeasureHttpRequest(trackedHttpReq, func() { err = c.Next() })
-				return err
-			} else {
-				return c.Next()
+				k.TrackHttpRequestDuration(trackedHttpReq, duration)
 			}
+
+			return err
 		} else {
 			return c.Next()
 		}
@@ -44,16 +58,29 @@ func requestTracker(k *kero.Kero) fiber.Handler {
 
 func trackedHttpReqFromCtx(c *fiber.Ctx) kero.TrackedHttpReq {
 	return kero.TrackedHttpReq{
-		Method:   c.Method(),
-		Path:     c.Path(),
-		Headers:  copyHeaders(c.GetReqHeaders()),
-		ClientIp: c.IP(),
-		Query:    copyQuery(c.Queries()),
-		// (TODO) How to get the route in Fiber given: https://docs.gofiber.io/api/ctx#route
-		// Route: c.Route().Path,
+		Method:     c.Method(),
+		Path:       c.Path(),
+		Headers:    copyHeaders(c.GetReqHeaders()),
+		Query:      copyQuery(c.Queries()),
+		RemoteAddr: c.Context().RemoteAddr().String(),
 	}
 }
 
+// statusCode returns the status code of the response. Errors returned by handlers are
+// turned into responses by Fiber's error handler only after the middleware has finished.
+func statusCode(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+
+	return fiber.StatusInternalServerError
+}
+
 func copyHeaders(h map[string][]string) http.Header {
 	headers := http.Header{}
 
@@ -82,10 +109,22 @@ func mountDashboard(app *fiber.App, k *kero.Kero, auth basicauth.Config) {
 
 	group := app.Group(k.DashboardPath, basicauth.New(auth))
 	group.Get("", func(c *fiber.Ctx) error {
+		query, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+		if err != nil {
+			return c.Status(http.StatusBadRequest).SendString(err.Error())
+		}
+		dash := kero.DefaultDashboard
+		if query.Has(kero.DashboardExportParam) {
+			return adaptor.HTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				dash.ServeStatCSV(k, w, query)
+			})(c)
+		}
+		if err := dash.LoadDataFromQuery(k, query); err != nil {
+			return c.Status(http.StatusBadRequest).SendString(err.Error())
+		}
+
 		c.Status(http.StatusOK)
 		c.Set("Content-Type", "text/html;charset=utf-8")
-		dash := kero.DefaultDashboard
-		dash.LoadData(k, c.Query("t"))
 
 		var buf bytes.Buffer
 		wr := io.Writer(&buf)
@@ -102,6 +141,7 @@ func mountDashboard(app *fiber.App, k *kero.Kero, auth basicauth.Config) {
 		Root:   httpFS,
 		Browse: false,
 	}))
+	group.Get(kero.APIPath+"/*", adaptor.HTTPHandler(k.APIHandler()))
 }
 
 // mountPixel adds the pixel tracker to the Fiber app.
@@ -129,3 +169,15 @@ func mountPixel(app *fiber.App, k *kero.Kero) {
 		return c.Send(kero.Pixel)
 	})
 }
+
+// mountBeacon adds the endpoint receiving events from the browser and the beacon scripts to the Fiber app.
+func mountBeacon(app *fiber.App, k *kero.Kero) {
+	if len(k.BeaconPath) == 0 {
+		return
+	}
+
+	handler := adaptor.HTTPHandler(k.BeaconHandler())
+	app.Post(k.BeaconPath, handler)
+	app.Get(k.BeaconPath+kero.BeaconScriptPath, handler)
+	app.Get(k.BeaconPath+kero.BeaconLinksScriptPath, handler)
+}
@@ -23,6 +23,7 @@ func createServer(t *testing.T) (*fiber.App, *kero.Kero) {
 		kero.WithRequestMeasurements(true),
 		kero.WithBotsIgnored(false),
 		kero.WithPixelPath(ktest.PixelPath),
+		kero.WithBeaconPath(ktest.BeaconPath),
 	)
 
 	keromw.Mount(app, k, basicauth.Config{
@@ -70,6 +71,8 @@ func TestRequestTracker(t *testing.T) {
 	}
 
 	ktest.ExpectRequestsTracked(t, k)
+	ktest.ExpectRouteTracked(t, k, ktest.HelloPath)
+	ktest.ExpectStatusCodesTracked(t, k)
 }
 
 func TestMeasureDuration(t *testing.T) {
@@ -98,6 +101,28 @@ func TestPixel(t *testing.T) {
 	}
 }
 
+func TestBeacon(t *testing.T) {
+	app, k := createServer(t)
+	defer k.Close()
+
+	codes := []int{}
+	for _, req := range ktest.BeaconRequests() {
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal("request failed", err)
+		}
+		codes = append(codes, resp.StatusCode)
+	}
+	ktest.ExpectBeaconStatusCodes(t, codes)
+	ktest.ExpectBeaconToTrack(t, k)
+
+	for _, req := range ktest.BeaconScriptRequests() {
+		if resp, err := app.Test(req); err != nil || resp.StatusCode != 200 {
+			t.Error("expected script to be served", req.URL.Path, err)
+		}
+	}
+}
+
 func TestIgnoreCustomPath(t *testing.T) {
 	app, k := createServer(t)
 	defer k.Close()
@@ -6,16 +6,18 @@ import (
 	"io/fs"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/josip/kero"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Mount registers the dashboard UI, request tracking and the pixel tracker endpoints on the Gin server
+// Mount registers the dashboard UI, request tracking, the pixel tracker and the beacon endpoints on the Gin server
 func Mount(r *gin.Engine, k *kero.Kero, auth gin.Accounts) error {
 	mountDashboard(r, k, auth)
 	mountPixel(r, k)
+	mountBeacon(r, k)
 	r.Use(requestTracker(k))
 	return nil
 }
@@ -26,11 +28,15 @@ func requestTracker(k *kero.Kero) gin.HandlerFunc {
 		if k.ShouldTrackHttpRequest(ctx.Request.URL.Path) {
 			trackedHttpReq := kero.TrackedRequestFromHttp(ctx.Request)
 			trackedHttpReq.Route = ctx.FullPath()
+
+			start := time.Now()
+			ctx.Next()
+			duration := time.Since(start)
+
+			trackedHttpReq.StatusCode = ctx.Writer.Status()
 			k.TrackHttpRequest(trackedHttpReq)
 			if k.MeasureRequestDuration {
-				k.MeasureHttpRequest(trackedHttpReq, ctx.Next)
-			} else {
-				ctx.Next()
+				k.TrackHttpRequestDuration(trackedHttpReq, duration)
 			}
 		} else {
 			ctx.Next()
@@ -46,16 +52,26 @@ func mountDashboard(r *gin.Engine, k *kero.Kero, accounts gin.Accounts) {
 
 	group := r.Group(k.DashboardPath, gin.BasicAuth(accounts))
 	group.GET("", func(ctx *gin.Context) {
+		query := ctx.Request.URL.Query()
+		dash := kero.DefaultDashboard
+		if query.Has(kero.DashboardExportParam) {
+			dash.ServeStatCSV(k, ctx.Writer, query)
+			return
+		}
+		if err := dash.LoadDataFromQuery(k, query); err != nil {
+			ctx.String(http.StatusBadRequest, err.Error())
+			return
+		}
+
 		ctx.Status(http.StatusOK)
 		ctx.Header("Content-Type", "text/html;charset=utf-8")
-		dash := kero.DefaultDashboard
-		dash.LoadData(k, ctx.Query("t"))
 
 		if err := dash.Write(ctx.Writer); err != nil {
 			fmt.Println("[kero] error rendering template", err)
 		}
 	})
 	group.StaticFS("assets", httpFS)
+	group.GET(kero.APIPath+"/*endpoint", gin.WrapH(k.APIHandler()))
 }
 
 // mountPixel adds the pixel tracker to the Gin router.
@@ -85,3 +101,15 @@ func mountPixel(r *gin.Engine, k *kero.Kero) {
 		ctx.DataFromReader(http.StatusOK, kero.PixelSize, "image/gif", reader, headers)
 	})
 }
+
+// mountBeacon adds the endpoint receiving events from the browser and the beacon scripts to the Gin router.
+func mountBeacon(r *gin.Engine, k *kero.Kero) {
+	if len(k.BeaconPath) == 0 {
+		return
+	}
+
+	handler := gin.WrapH(k.BeaconHandler())
+	r.POST(k.BeaconPath, handler)
+	r.GET(k.BeaconPath+kero.BeaconScriptPath, handler)
+	r.GET(k.BeaconPath+kero.BeaconLinksScriptPath, handler)
+}
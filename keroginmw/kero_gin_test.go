@@ -25,6 +25,7 @@ func createServer(t *testing.T) (*gin.Engine, *kero.Kero) {
 		kero.WithRequestMeasurements(true),
 		kero.WithBotsIgnored(false),
 		kero.WithPixelPath(ktest.PixelPath),
+		kero.WithBeaconPath(ktest.BeaconPath),
 	)
 
 	keromw.Mount(r, k, gin.Accounts{
@@ -66,6 +67,8 @@ func TestRequestTracker(t *testing.T) {
 	}
 
 	ktest.ExpectRequestsTracked(t, k)
+	ktest.ExpectRouteTracked(t, k, ktest.HelloPath)
+	ktest.ExpectStatusCodesTracked(t, k)
 }
 
 func TestMeasureDuration(t *testing.T) {
@@ -91,6 +94,28 @@ func TestPixel(t *testing.T) {
 	ktest.ExpectPixelToTrack(t, k)
 }
 
+func TestBeacon(t *testing.T) {
+	r, k := createServer(t)
+	defer k.Close()
+
+	codes := []int{}
+	for _, req := range ktest.BeaconRequests() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	ktest.ExpectBeaconStatusCodes(t, codes)
+	ktest.ExpectBeaconToTrack(t, k)
+
+	for _, req := range ktest.BeaconScriptRequests() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != 200 || w.Body.Len() == 0 {
+			t.Error("expected script to be served", req.URL.Path, "got", w.Code)
+		}
+	}
+}
+
 func TestIgnoreCustomPath(t *testing.T) {
 	r, k := createServer(t)
 	defer k.Close()
@@ -0,0 +1,191 @@
+package keronethttp
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/josip/kero"
+)
+
+// Accounts maps usernames to passwords of users allowed to access the dashboard.
+type Accounts map[string]string
+
+// Mount registers the dashboard UI, the pixel tracker and the beacon endpoints on the mux and returns
+// the mux wrapped with the request tracker. The returned handler should be passed to the server instead of the mux:
+//
+//	mux := http.NewServeMux()
+//	handler := keronethttp.Mount(mux, k, keronethttp.Accounts{"admin": "pass"})
+//	http.ListenAndServe(":8080", handler)
+func Mount(mux *http.ServeMux, k *kero.Kero, auth Accounts) http.Handler {
+	mountDashboard(mux, k, auth)
+	mountPixel(mux, k)
+	mountBeacon(mux, k)
+	return RequestTracker(k)(mux)
+}
+
+// RequestTracker is net/http middleware that installs the request tracker.
+// Route of the request is read from [http.Request.Pattern] after next has handled the request,
+// meaning that next should be the [http.ServeMux] itself or a handler wrapping it.
+func RequestTracker(k *kero.Kero) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !k.ShouldTrackHttpRequest(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			trackedHttpReq := kero.TrackedRequestFromHttp(r)
+			rec := &statusRecorder{ResponseWriter: w}
+			start := time.Now()
+			next.ServeHTTP(rec, r)
+			duration := time.Since(start)
+
+			trackedHttpReq.Route = routeFromPattern(r.Pattern)
+			trackedHttpReq.StatusCode = rec.Status()
+			k.TrackHttpRequest(trackedHttpReq)
+			if k.MeasureRequestDuration {
+				k.TrackHttpRequestDuration(trackedHttpReq, duration)
+			}
+		})
+	}
+}
+
+// statusRecorder captures the status code written by the handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	if r.status == 0 {
+		r.status = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap gives http.ResponseController access to the original ResponseWriter.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Status returns the written status code. Handlers which haven't written anything respond with 200 OK.
+func (r *statusRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// routeFromPattern strips the method from the pattern, ie. "GET /user/{id}" becomes "/user/{id}".
+// Method is tracked separately.
+func routeFromPattern(pattern string) string {
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		return strings.TrimLeft(pattern[i+1:], " \t")
+	}
+
+	return pattern
+}
+
+// basicAuth protects the handler with HTTP Basic Auth using the provided accounts.
+func basicAuth(accounts Accounts, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); ok {
+			if expected, exists := accounts[user]; exists && subtle.ConstantTimeCompare([]byte(pass), []byte(expected)) == 1 {
+				handler.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="Authorization Required"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+// mountDashboard mounts the Kero dashboard interface.
+// The path is specified using `WithDashboardPath` configuration option when creating the Kero instance.
+func mountDashboard(mux *http.ServeMux, k *kero.Kero, accounts Accounts) {
+	assetsFs, _ := fs.Sub(kero.DashboardWebAssets, "assets")
+	httpFS := http.FS(assetsFs)
+
+	mux.Handle("GET "+k.DashboardPath, basicAuth(accounts, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		dash := kero.DefaultDashboard
+		if query.Has(kero.DashboardExportParam) {
+			dash.ServeStatCSV(k, w, query)
+			return
+		}
+		if err := dash.LoadDataFromQuery(k, query); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := dash.Write(&buf); err != nil {
+			fmt.Println("[kero] error rendering template", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html;charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.Bytes())
+	})))
+
+	assetsPath := k.DashboardPath + "/assets"
+	mux.Handle("GET "+assetsPath+"/", basicAuth(accounts, http.StripPrefix(assetsPath, http.FileServer(httpFS))))
+	mux.Handle("GET "+k.DashboardPath+kero.APIPath+"/", basicAuth(accounts, k.APIHandler()))
+}
+
+// mountPixel adds the pixel tracker to the mux.
+func mountPixel(mux *http.ServeMux, k *kero.Kero) {
+	if len(k.PixelPath) == 0 {
+		return
+	}
+
+	mux.HandleFunc("GET "+k.PixelPath, func(w http.ResponseWriter, r *http.Request) {
+		if referrer, err := url.Parse(r.Referer()); err == nil {
+			if k.ShouldTrackHttpRequest(referrer.Path) {
+				trackedHttpReq := kero.TrackedRequestFromHttp(r)
+				trackedHttpReq.Path = referrer.Path
+				trackedHttpReq.Route = ""
+				trackedHttpReq.Headers = r.Header.Clone()
+				trackedHttpReq.Headers.Del("Referer")
+
+				k.TrackHttpRequest(trackedHttpReq)
+			}
+		}
+
+		w.Header().Set("Content-Type", "image/gif")
+		w.Header().Set("Content-Length", strconv.FormatInt(kero.PixelSize, 10))
+		w.Header().Set("Expires", "Tue, 12 Sept 2023 06:00:00 GMT")
+		w.Header().Set("Cache-Control", "private, max-age=0, no-cache, must-revalidate, proxy-revalidate")
+		w.WriteHeader(http.StatusOK)
+		w.Write(kero.Pixel)
+	})
+}
+
+// mountBeacon adds the endpoint receiving events from the browser and the beacon scripts to the mux.
+func mountBeacon(mux *http.ServeMux, k *kero.Kero) {
+	if len(k.BeaconPath) == 0 {
+		return
+	}
+
+	handler := k.BeaconHandler()
+	mux.Handle("POST "+k.BeaconPath, handler)
+	mux.Handle("GET "+k.BeaconPath+kero.BeaconScriptPath, handler)
+	mux.Handle("GET "+k.BeaconPath+kero.BeaconLinksScriptPath, handler)
+}
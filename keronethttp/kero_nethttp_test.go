@@ -0,0 +1,127 @@
+package keronethttp_test
+
+import (
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	_ "image/gif"
+
+	"github.com/josip/kero"
+	ktest "github.com/josip/kero/internal/kerotest"
+	keromw "github.com/josip/kero/keronethttp"
+)
+
+func createServer(t *testing.T) (http.Handler, *kero.Kero) {
+	mux := http.NewServeMux()
+
+	k, _ := kero.New(
+		kero.WithDB(t.TempDir()),
+		kero.WithDashboardPath(ktest.DashPath),
+		kero.WithWebAssetsIgnored(true),
+		kero.WithRequestMeasurements(true),
+		kero.WithBotsIgnored(false),
+		kero.WithPixelPath(ktest.PixelPath),
+		kero.WithBeaconPath(ktest.BeaconPath),
+	)
+
+	handler := keromw.Mount(mux, k, keromw.Accounts{
+		ktest.DashUsername: ktest.DashPass,
+	})
+
+	mux.HandleFunc("GET "+ktest.HelloPattern, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello " + r.PathValue("id")))
+	})
+
+	mux.HandleFunc("GET "+ktest.WaitPath, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(ktest.WaitDuration)
+		w.Write([]byte("Done waiting"))
+	})
+
+	return handler, k
+}
+
+func TestMountDashboard(t *testing.T) {
+	h, k := createServer(t)
+	defer k.Close()
+
+	for _, test := range ktest.DashboardTests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, test.Request())
+
+		if test.HasFailed(w.Code) {
+			t.Error(test.Description, ", response code was: ", w.Code)
+		}
+	}
+}
+
+func TestRequestTracker(t *testing.T) {
+	h, k := createServer(t)
+	defer k.Close()
+
+	for _, test := range ktest.TrackingTests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, test.Request())
+	}
+
+	ktest.ExpectRequestsTracked(t, k)
+	ktest.ExpectRouteTracked(t, k, ktest.HelloPattern)
+	ktest.ExpectStatusCodesTracked(t, k)
+}
+
+func TestMeasureDuration(t *testing.T) {
+	h, k := createServer(t)
+	defer k.Close()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, ktest.WaitRequest)
+
+	ktest.ExpectDurationTracked(t, k)
+}
+
+func TestPixel(t *testing.T) {
+	h, k := createServer(t)
+	defer k.Close()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, ktest.PixelRequest())
+	if _, format, err := image.DecodeConfig(w.Body); format != "gif" || err != nil {
+		t.Error("pixel was not a valid gif file", format, err)
+	}
+
+	ktest.ExpectPixelToTrack(t, k)
+}
+
+func TestBeacon(t *testing.T) {
+	h, k := createServer(t)
+	defer k.Close()
+
+	codes := []int{}
+	for _, req := range ktest.BeaconRequests() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	ktest.ExpectBeaconStatusCodes(t, codes)
+	ktest.ExpectBeaconToTrack(t, k)
+
+	for _, req := range ktest.BeaconScriptRequests() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != 200 || w.Body.Len() == 0 {
+			t.Error("expected script to be served", req.URL.Path, "got", w.Code)
+		}
+	}
+}
+
+func TestIgnoreCustomPath(t *testing.T) {
+	h, k := createServer(t)
+	defer k.Close()
+
+	k.IgnoredPrefixes = append(k.IgnoredPrefixes, ktest.PrefixToIgnore)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, ktest.IgnoredHelloRequest())
+	ktest.ExpectHelloIgnored(t, k)
+}
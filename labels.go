@@ -0,0 +1,50 @@
+package kero
+
+import (
+	"context"
+	"slices"
+
+	plabels "github.com/prometheus/prometheus/model/labels"
+)
+
+// MetricNames returns sorted names of metrics tracked in the timeframe.
+// Names are read from the index of the database, which covers blocks of time rather than single events,
+// so names of metrics tracked shortly before or after the timeframe can be included as well.
+// The same applies to [Kero.LabelNames] and [Kero.LabelValues].
+func (k *Kero) MetricNames(start int64, end int64) ([]string, error) {
+	return k.LabelValues("", MetricName, nil, start, end)
+}
+
+// LabelNames returns sorted names of labels, except for the metric name, used by matching events.
+// Labels of all metrics are returned if the metric is empty.
+func (k *Kero) LabelNames(metric string, labelFilters MetricLabels, start int64, end int64) ([]string, error) {
+	q, err := k.db.Querier(dbTimeRange(start, end))
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+
+	names, _, err := q.LabelNames(context.Background(), queryMatchers(metric, labelFilters)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(names, func(name string) bool { return name == plabels.MetricName }), nil
+}
+
+// LabelValues returns sorted distinct values of the label of matching events, ie. paths with [HttpPathLabel].
+// Values from all metrics are returned if the metric is empty.
+func (k *Kero) LabelValues(metric string, label string, labelFilters MetricLabels, start int64, end int64) ([]string, error) {
+	q, err := k.db.Querier(dbTimeRange(start, end))
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+
+	values, _, err := q.LabelValues(context.Background(), label, queryMatchers(metric, labelFilters)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(values, func(value string) bool { return len(value) == 0 }), nil
+}
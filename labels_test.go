@@ -0,0 +1,31 @@
+package kero
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLabelDiscovery(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()))
+	defer k.Close()
+
+	k.Track("signup", MetricLabels{"plan": "pro", VisitorIdLabel: "a"}, 1)
+	k.Track("signup", MetricLabels{"plan": "free", "source": "ad"}, 1)
+	k.Track(HttpReqMetricName, MetricLabels{HttpPathLabel: "/"}, 1)
+	k.Flush()
+
+	now := time.Now().Unix()
+	if names, err := k.MetricNames(0, now); err != nil || !slices.Equal(names, []string{HttpReqMetricName, "signup"}) {
+		t.Error("unexpected metric names", names, err)
+	}
+	if labels, err := k.LabelNames("signup", nil, 0, now); err != nil || !slices.Equal(labels, []string{VisitorIdLabel, "plan", "source"}) {
+		t.Error("unexpected label names", labels, err)
+	}
+	if labels, _ := k.LabelNames("", nil, 0, now); !slices.Contains(labels, HttpPathLabel) {
+		t.Error("expected labels of all metrics", labels)
+	}
+	if values, err := k.LabelValues("signup", "plan", MetricLabels{"source": "ad"}, 0, now); err != nil || !slices.Equal(values, []string{"free"}) {
+		t.Error("unexpected label values", values, err)
+	}
+}
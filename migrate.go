@@ -0,0 +1,280 @@
+package kero
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/log"
+	plabels "github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+// name of the file in the database folder storing the version of data format
+const dbFormatFileName = "kero_format"
+
+// timestamps stored in milliseconds, as expected by the TSDB
+const dbFormatMillis = "ms"
+
+const legacyBackupSuffix = ".seconds-backup"
+const migrationSuffix = ".migrating"
+
+// data is rewritten in windows of one day (in seconds) to limit memory usage
+const migrationWindow = int64(24 * 60 * 60)
+const migrationCommitSize = 10000
+
+var ErrLegacyDB = errors.New("kero database was created by an older version storing timestamps in seconds, run kero.MigrateDB before opening it")
+
+// MigrateDB rewrites the database created by older versions of Kero, which stored timestamps in seconds
+// instead of milliseconds, making retention and compaction of the data incorrect.
+//
+// Original database is kept in the folder with ".seconds-backup" suffix and can be deleted once the migration succeeds.
+// Migrating the database while Kero is running is not supported. Databases which have been already migrated are skipped.
+//
+// After the migration data older than the configured retention period will be removed when the database is opened.
+func MigrateDB(dbPath string) error {
+	if format, err := readDBFormat(dbPath); err != nil {
+		return err
+	} else if format == dbFormatMillis {
+		return nil
+	}
+
+	if _, err := os.Stat(dbPath); err != nil {
+		return err
+	}
+
+	backupPath := dbPath + legacyBackupSuffix
+	if _, err := os.Stat(backupPath); err == nil {
+		return fmt.Errorf("backup of the database already exists: %s", backupPath)
+	}
+
+	migratedPath := dbPath + migrationSuffix
+	if err := os.RemoveAll(migratedPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(migratedPath, 0o777); err != nil {
+		return err
+	}
+
+	if err := rewriteTimestamps(dbPath, migratedPath); err != nil {
+		os.RemoveAll(migratedPath)
+		return fmt.Errorf("failed to migrate kero database: %w", err)
+	}
+
+	if err := writeDBFormat(migratedPath); err != nil {
+		return err
+	}
+
+	if err := os.Rename(dbPath, backupPath); err != nil {
+		return err
+	}
+
+	return os.Rename(migratedPath, dbPath)
+}
+
+// prepareDBFormat fails if the database uses an outdated format, otherwise marks new databases as using the latest one.
+func prepareDBFormat(dbPath string) error {
+	format, err := readDBFormat(dbPath)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case dbFormatMillis:
+		return nil
+	case "":
+		if isLegacyDB(dbPath) {
+			return ErrLegacyDB
+		}
+		if err := os.MkdirAll(dbPath, 0o777); err != nil {
+			return err
+		}
+		return writeDBFormat(dbPath)
+	default:
+		return fmt.Errorf("unknown kero database format: %s", format)
+	}
+}
+
+func readDBFormat(dbPath string) (string, error) {
+	format, err := os.ReadFile(filepath.Join(dbPath, dbFormatFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+
+	return strings.TrimSpace(string(format)), err
+}
+
+func writeDBFormat(dbPath string) error {
+	return os.WriteFile(filepath.Join(dbPath, dbFormatFileName), []byte(dbFormatMillis+"\n"), 0o666)
+}
+
+// isLegacyDB checks if the folder contains TSDB data without the format file.
+func isLegacyDB(dbPath string) bool {
+	entries, err := os.ReadDir(dbPath)
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if entry.Name() == "wal" {
+			return true
+		}
+		if _, err := os.Stat(filepath.Join(dbPath, entry.Name(), "meta.json")); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rewriteTimestamps copies all data from the source database into new blocks in dst with timestamps in milliseconds.
+func rewriteTimestamps(src, dst string) error {
+	db, err := tsdb.OpenDBReadOnly(src, os.TempDir(), nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// data not yet compacted into blocks is written into a temporary block
+	walDir, err := os.MkdirTemp("", "kero-migration-wal")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(walDir)
+
+	if err := db.FlushWAL(walDir); err != nil {
+		return err
+	}
+
+	// loaded only after flushing the WAL since it reopens the blocks
+	blocks, err := db.Blocks()
+	if err != nil {
+		return err
+	}
+
+	walBlocks, err := openBlocks(walDir)
+	for _, b := range walBlocks {
+		defer b.Close()
+		blocks = append(blocks, b)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	mint, maxt := int64(math.MaxInt64), int64(math.MinInt64)
+	for _, b := range blocks {
+		mint = min(mint, b.Meta().MinTime)
+		maxt = max(maxt, b.Meta().MaxTime)
+	}
+
+	for start := mint - mint%migrationWindow; start < maxt; start += migrationWindow {
+		if err := rewriteTimestampsInWindow(blocks, dst, start, start+migrationWindow-1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func rewriteTimestampsInWindow(blocks []tsdb.BlockReader, dst string, start, end int64) error {
+	ctx := context.Background()
+	w, err := tsdb.NewBlockWriter(log.NewNopLogger(), dst, migrationWindow*1000)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	catchAllMatcher := plabels.MustNewMatcher(plabels.MatchRegexp, plabels.MetricName, ".*")
+	app := w.Appender(ctx)
+	appended, failed := 0, 0
+	var lastErr error
+
+	for _, b := range blocks {
+		if meta := b.Meta(); meta.MaxTime < start || meta.MinTime > end {
+			continue
+		}
+
+		q, err := tsdb.NewBlockQuerier(b, start, end)
+		if err != nil {
+			return err
+		}
+
+		ss := q.Select(ctx, false, nil, catchAllMatcher)
+		for ss.Next() {
+			series := ss.At()
+			it := series.Iterator(nil)
+			for it.Next() == chunkenc.ValFloat {
+				ts, val := it.At()
+				if _, err := app.Append(0, series.Labels(), ts*1000, val); err != nil {
+					failed += 1
+					lastErr = err
+					continue
+				}
+
+				appended += 1
+				if appended%migrationCommitSize == 0 {
+					if err := app.Commit(); err != nil {
+						q.Close()
+						return err
+					}
+					app = w.Appender(ctx)
+				}
+			}
+		}
+
+		err = ss.Err()
+		q.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := app.Commit(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to append %d of %d events: %w", failed, failed+appended, lastErr)
+	}
+
+	if appended == 0 {
+		return nil
+	}
+
+	_, err = w.Flush(ctx)
+	return err
+}
+
+func openBlocks(dir string) ([]*tsdb.Block, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []*tsdb.Block
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		b, err := tsdb.OpenBlock(log.NewNopLogger(), filepath.Join(dir, entry.Name()), nil)
+		if err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, b)
+	}
+
+	return blocks, nil
+}
@@ -0,0 +1,114 @@
+package kero
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	plabels "github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+)
+
+// createLegacyDB creates a database as it was written by older versions of kero, with timestamps in seconds.
+// Half of the events are stored in a block and half only in the WAL.
+func createLegacyDB(t *testing.T, dbPath string, events int) {
+	ctx := context.Background()
+	now := time.Now().Unix()
+
+	w, err := tsdb.NewBlockWriter(log.NewNopLogger(), dbPath, migrationWindow*1000)
+	if err != nil {
+		t.Fatal("failed to create block writer", err)
+	}
+	app := w.Appender(ctx)
+	for i := 0; i < events/2; i++ {
+		lbls := plabels.FromStrings(plabels.MetricName, HttpReqMetricName, HttpPathLabel, "/block")
+		app.Append(0, lbls, now-int64(events-i)*60, 1)
+	}
+	if err := app.Commit(); err != nil {
+		t.Fatal("failed to commit to block", err)
+	}
+	if _, err := w.Flush(ctx); err != nil {
+		t.Fatal("failed to write block", err)
+	}
+	w.Close()
+
+	db, err := tsdb.Open(dbPath, nil, nil, tsdb.DefaultOptions(), nil)
+	if err != nil {
+		t.Fatal("failed to open legacy db", err)
+	}
+	app = db.Appender(ctx)
+	for i := 0; i < events/2; i++ {
+		lbls := plabels.FromStrings(plabels.MetricName, HttpReqMetricName, HttpPathLabel, "/wal")
+		app.Append(0, lbls, now-int64(events/2-i), 1)
+	}
+	if err := app.Commit(); err != nil {
+		t.Fatal("failed to commit to wal", err)
+	}
+	db.Close()
+}
+
+func TestMigrateDB(t *testing.T) {
+	dbPath := t.TempDir() + "/kero"
+	events := 20
+	createLegacyDB(t, dbPath, events)
+
+	if _, err := New(WithDB(dbPath)); !errors.Is(err, ErrLegacyDB) {
+		t.Fatal("expected legacy database to be rejected, got", err)
+	}
+
+	if err := MigrateDB(dbPath); err != nil {
+		t.Fatal("failed to migrate db", err)
+	}
+	if _, err := os.Stat(dbPath + legacyBackupSuffix); err != nil {
+		t.Error("expected backup of the original database", err)
+	}
+	// running it again is a no-op
+	if err := MigrateDB(dbPath); err != nil {
+		t.Fatal("failed to skip migrated db", err)
+	}
+
+	k, err := New(WithDB(dbPath))
+	if err != nil {
+		t.Fatal("failed to open migrated db", err)
+	}
+	defer k.Close()
+
+	now := time.Now()
+	if count := k.Count(HttpReqMetricName, now.Add(-time.Hour).Unix(), now.Unix()); count != events {
+		t.Error("expected", events, "migrated events, got", count)
+	}
+
+	for _, path := range []string{"/block", "/wal"} {
+		res, err := k.Query(HttpReqMetricName, MetricLabels{HttpPathLabel: path}, 0, now.Unix())
+		if err != nil {
+			t.Fatal("failed to query", err)
+		}
+		if len(res) != events/2 {
+			t.Error("expected", events/2, "events from", path, "got", len(res))
+		}
+		if len(res) > 0 && now.Sub(res[0].Time()) > time.Hour {
+			t.Error("expected migrated timestamps to be recent, got", res[0].Time())
+		}
+	}
+}
+
+func TestNewDBHasFormat(t *testing.T) {
+	dbPath := t.TempDir()
+	k, err := New(WithDB(dbPath))
+	if err != nil {
+		t.Fatal("failed to create kero", err)
+	}
+	k.Close()
+
+	if format, _ := readDBFormat(dbPath); format != dbFormatMillis {
+		t.Error("expected new database to use milliseconds, got", format)
+	}
+	k, err = New(WithDB(dbPath))
+	if err != nil {
+		t.Fatal("failed to reopen database", err)
+	}
+	defer k.Close()
+}
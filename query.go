@@ -2,6 +2,10 @@ package kero
 
 import (
 	"context"
+	"fmt"
+	"iter"
+	"maps"
+	"math"
 	"sort"
 	"strings"
 	"time"
@@ -10,61 +14,132 @@ import (
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 )
 
+// Metric is a single tracked event.
 type Metric struct {
-	Ts     int64        `json:"timestamp"`
+	Ts     int64        `json:"timestamp"` // Unix time in seconds
 	Name   string       `json:"name"`
 	Labels MetricLabels `json:"labels"`
 	Value  float64      `json:"value"`
+
+	tsMillis int64 // used for ordering events tracked within the same second
 }
 
 type AggregatedMetric struct {
-	Label string  `json:"label"` // Metric label as it was recorded or formatted with GroupMetricBy
-	Value float64 `json:"value"`
+	Label string             `json:"label"` // Metric label as it was recorded or formatted with GroupMetricBy
+	Value float64            `json:"value"`
+	Extra map[string]float64 `json:"extra,omitempty"` // Additional values provided by some of the queries, ie. ExitRateKey
 }
 
 type GroupMetricBy func(m Metric) string
 
+// Time returns the time when the metric was tracked.
+func (m Metric) Time() time.Time {
+	return time.Unix(m.Ts, 0)
+}
+
+// dbTimeRange converts the timeframe in seconds, as used by the public API, to milliseconds stored in the database.
+// Both start and end are inclusive, with end including the whole last second.
+func dbTimeRange(start, end int64) (int64, int64) {
+	return start * 1000, end*1000 + 999
+}
+
 // Query looks for matching metrics within the specified timeframe.
+// Results are sorted by newest first. See [Kero.QueryIter] for going through large timeframes.
 func (k *Kero) Query(metric string, labelFilters MetricLabels, start int64, end int64) ([]Metric, error) {
-	q, err := k.db.Querier(start, end)
-	if err != nil {
-		return []Metric{}, err
+	var metrics []Metric
+	for m, err := range k.QueryIter(metric, labelFilters, start, end) {
+		if err != nil {
+			return []Metric{}, err
+		}
+
+		m.Labels = maps.Clone(m.Labels)
+		metrics = append(metrics, m)
 	}
-	defer q.Close()
 
+	sort.SliceStable(metrics, func(i, j int) bool { return metrics[i].tsMillis > metrics[j].tsMillis })
+
+	return metrics, nil
+}
+
+// QueryIter goes through matching metrics within the specified timeframe, reading them from the database one at a time.
+// Unlike with [Kero.Query], metrics are grouped by their labels and sorted by oldest first only within the group.
+// Metrics from the same group share the Labels map, so it must not be modified and should be copied if retained after the iteration.
+// If the query fails, the error is yielded with an empty metric and the iteration stops.
+//
+//	for m, err := range k.QueryIter("http_req", nil, start, end) {
+//	  if err != nil {
+//	    return err
+//	  }
+//	  fmt.Println(m.Time(), m.Labels["$http_path"])
+//	}
+func (k *Kero) QueryIter(metric string, labelFilters MetricLabels, start int64, end int64) iter.Seq2[Metric, error] {
+	return func(yield func(Metric, error) bool) {
+		q, err := k.db.Querier(dbTimeRange(start, end))
+		if err != nil {
+			yield(Metric{}, err)
+			return
+		}
+		defer q.Close()
+
+		ss := q.Select(context.Background(), false, nil, queryMatchers(metric, labelFilters)...)
+		var it chunkenc.Iterator
+		for ss.Next() {
+			series := ss.At()
+			metricLabels := labelsToMap(series.Labels())
+			it = series.Iterator(it)
+			for it.Next() == chunkenc.ValFloat {
+				ts, val := it.At()
+				if !yield(Metric{ts / 1000, metricLabels[plabels.MetricName], metricLabels, val, ts}, nil) {
+					return
+				}
+			}
+
+			if err := it.Err(); err != nil {
+				yield(Metric{}, err)
+				return
+			}
+		}
+
+		if err := ss.Err(); err != nil {
+			yield(Metric{}, err)
+		}
+	}
+}
+
+// queryMatchers returns matchers for the metric and filters, matching all events if both are empty.
+func queryMatchers(metric string, labelFilters MetricLabels) []*plabels.Matcher {
 	matchers := matchersForLabels(metric, labelFilters)
 	if len(matchers) == 0 {
 		catchAllMatcher, _ := plabels.NewMatcher(plabels.MatchRegexp, plabels.MetricName, ".*")
 		matchers = append(matchers, catchAllMatcher)
 	}
-	ss := q.Select(context.Background(), true, nil, matchers...)
-	var metrics []Metric
-	for ss.Next() {
-		match := ss.At()
-		labels := match.Labels()
-		it := match.Iterator(nil)
-		for it.Next() == chunkenc.ValFloat {
-			ts, val := it.At()
-			metricLabels := labelsToMap(labels)
-			metrics = append(metrics, Metric{ts, metricLabels[plabels.MetricName], metricLabels, val})
-		}
-	}
-
-	sort.SliceStable(metrics, func(i, j int) bool { return metrics[i].Ts > metrics[j].Ts })
 
-	return metrics, nil
+	return matchers
 }
 
 // Count is an optimized version of AggregateDistinct counting occurrences of a metric in the specified timeframe.
 func (k *Kero) Count(metric string, start int64, end int64) int {
-	q, err := k.db.Querier(start, end)
+	return k.CountWithFilters(metric, nil, start, end)
+}
+
+// CountWithFilters counts occurrences of a metric matching the label filters in the specified timeframe.
+// Counts are read from rollups when enabled with [WithRollups] and the filters allow it.
+func (k *Kero) CountWithFilters(metric string, labelFilters MetricLabels, start int64, end int64) int {
+	if rq, ok := k.rollupQueryFor(metric, "", labelFilters); ok {
+		counts := [][2]int64{{start, 0}}
+		if err := k.countRollups(rq, labelFilters, [][2]int64{{start, end}}, counts); err != nil {
+			return 0
+		}
+		return int(counts[0][1])
+	}
+
+	q, err := k.db.Querier(dbTimeRange(start, end))
 	if err != nil {
 		return 0
 	}
 	defer q.Close()
 
-	matcher, _ := plabels.NewMatcher(plabels.MatchRegexp, plabels.MetricName, metric)
-	ss := q.Select(context.Background(), true, nil, matcher)
+	ss := q.Select(context.Background(), true, nil, matchersForLabels(metric, labelFilters)...)
 
 	count := 0
 	for ss.Next() {
@@ -85,33 +160,66 @@ func (k *Kero) Count(metric string, start int64, end int64) int {
 //   - duration up to 31 days (ie. 1 month): 1 day
 //   - duration up to 93 days (ie. 3 months): 1 week
 //   - for durations longer than 3 months: 1 month
+//
+// Subdivisions follow the calendar: days start at midnight in the timezone set with [WithTimezone],
+// weeks on the day set with [WithWeekStart] and months on their 1st. The first subdivision starts at start time,
+// so it's shorter if start isn't at the beginning of a subdivision. Use [Kero.CountHistogramWithInterval] to set the subdivision.
 func (k *Kero) CountHistogram(metric string, start int64, end int64) [][2]int64 {
-	aggUnit := selectTimeUnitForTimeframe(start, end)
-	timeframes := timeSplits(aggUnit, start, end)
-	counts := make([][2]int64, len(timeframes))
+	return k.CountHistogramWithFilters(metric, nil, start, end)
+}
 
+// CountHistogramWithFilters is the same as [Kero.CountHistogram] while counting only metrics matching the label filters.
+func (k *Kero) CountHistogramWithFilters(metric string, labelFilters MetricLabels, start int64, end int64) [][2]int64 {
+	return k.countHistogram(metric, labelFilters, k.histogramSplits(0, start, end, k.location))
+}
+
+// CountHistogramWithInterval is the same as [Kero.CountHistogramWithFilters] with subdivisions of the interval,
+// one of AggregateByHour to AggregateByYear. The interval is chosen automatically if it's 0.
+func (k *Kero) CountHistogramWithInterval(metric string, labelFilters MetricLabels, interval time.Duration, start int64, end int64) [][2]int64 {
+	return k.countHistogram(metric, labelFilters, k.histogramSplits(interval, start, end, k.location))
+}
+
+func (k *Kero) countHistogram(metric string, labelFilters MetricLabels, timeframes [][2]int64) [][2]int64 {
+	counts := make([][2]int64, len(timeframes))
 	for i, timeframe := range timeframes {
-		count := k.Count(metric, timeframe[0], timeframe[1])
-		counts[i] = [2]int64{timeframe[0], int64(count)}
+		counts[i][0] = timeframe[0]
 	}
 
+	if rq, ok := k.rollupQueryFor(metric, "", labelFilters); ok {
+		k.countRollups(rq, labelFilters, timeframes, counts)
+		return counts
+	}
+
+	k.forEachSampleInSplits(metric, labelFilters, timeframes, func(_ plabels.Labels, split int, samples int) {
+		counts[split][1] += int64(samples)
+	})
+
 	return counts
 }
 
 // CountVisitors counts number of unique visitors for which an event with matching filters has been tracked
 // within the specified timeframe.
+// Visitors are estimated when enabled with [WithApproximateVisitors].
 func (k *Kero) CountVisitors(metric string, labelFilters MetricLabels, start int64, end int64) (int, error) {
-	data, err := k.Query(metric, labelFilters, start, end)
-	if err != nil {
-		return 0, err
+	if k.approximateVisitors {
+		sketches, err := k.visitorSketches(metric, "", labelFilters, [][2]int64{{start, end}})
+		if err != nil {
+			return 0, err
+		}
+		if sketch, exists := sketches[0][""]; exists {
+			return int(sketch.Estimate()), nil
+		}
+		return 0, nil
 	}
 
-	visitorIds := make(map[string]bool)
-	for _, metric := range data {
-		if id, exists := metric.Labels[VisitorIdLabel]; exists {
-			if _, tracked := visitorIds[id]; !tracked {
-				visitorIds[id] = true
-			}
+	visitorIds := make(map[string]struct{})
+	for m, err := range k.QueryIter(metric, labelFilters, start, end) {
+		if err != nil {
+			return 0, err
+		}
+
+		if id, exists := m.Labels[VisitorIdLabel]; exists {
+			visitorIds[id] = struct{}{}
 		}
 	}
 
@@ -121,16 +229,47 @@ func (k *Kero) CountVisitors(metric string, labelFilters MetricLabels, start int
 // VisitorsHistogram returns a number of unique visitors per time subdivision in the specified timeframe.
 // See [Kero.CountHistogram] for reference on time subdivisions.
 func (k *Kero) VisitorsHistogram(metric string, filters MetricLabels, start int64, end int64) [][2]int64 {
-	timeframes := timeSplits(selectTimeUnitForTimeframe(start, end), start, end)
-	counts := make([][2]int64, len(timeframes))
+	return k.visitorsHistogram(metric, filters, k.histogramSplits(0, start, end, k.location))
+}
+
+// VisitorsHistogramWithInterval is the same as [Kero.VisitorsHistogram] with subdivisions of the interval,
+// see [Kero.CountHistogramWithInterval].
+func (k *Kero) VisitorsHistogramWithInterval(metric string, filters MetricLabels, interval time.Duration, start int64, end int64) [][2]int64 {
+	return k.visitorsHistogram(metric, filters, k.histogramSplits(interval, start, end, k.location))
+}
 
+func (k *Kero) visitorsHistogram(metric string, filters MetricLabels, timeframes [][2]int64) [][2]int64 {
+	counts := make([][2]int64, len(timeframes))
+	visitorIds := make([]map[string]struct{}, len(timeframes))
 	for i, timeframe := range timeframes {
-		count, err := k.CountVisitors(metric, filters, timeframe[0], timeframe[1])
+		counts[i][0] = timeframe[0]
+		visitorIds[i] = make(map[string]struct{})
+	}
+
+	if k.approximateVisitors {
+		sketches, err := k.visitorSketches(metric, "", filters, timeframes)
 		if err != nil {
-			count = 0
+			return counts
 		}
+		for i := range counts {
+			if sketch, exists := sketches[i][""]; exists {
+				counts[i][1] = int64(sketch.Estimate())
+			}
+		}
+		return counts
+	}
 
-		counts[i] = [2]int64{timeframe[0], int64(count)}
+	err := k.forEachSampleInSplits(metric, filters, timeframes, func(series plabels.Labels, split int, _ int) {
+		if id := series.Get(VisitorIdLabel); len(id) > 0 {
+			visitorIds[split][id] = struct{}{}
+		}
+	})
+	if err != nil {
+		return counts
+	}
+
+	for i := range counts {
+		counts[i][1] = int64(len(visitorIds[i]))
 	}
 
 	return counts
@@ -140,14 +279,45 @@ func (k *Kero) VisitorsHistogram(metric string, filters MetricLabels, start int6
 type AggregationMethod int
 
 const (
-	AggregateCount AggregationMethod = iota // Aggregates by counting number of matched events
-	AggregateSum                            // Aggregates by summing values of matched events
-	AggregateAvg                            // Aggregates by calculating an average value of matched events
+	AggregateCount  AggregationMethod = iota // Aggregates by counting number of matched events
+	AggregateSum                             // Aggregates by summing values of matched events
+	AggregateAvg                             // Aggregates by calculating an average value of matched events
+	AggregateMin                             // Aggregates by finding the lowest value of matched events
+	AggregateMax                             // Aggregates by finding the highest value of matched events
+	AggregateStdDev                          // Aggregates by calculating the standard deviation of values of matched events
+	AggregateP50                             // Aggregates by calculating the 50th percentile (ie. median) of values of matched events
+	AggregateP75                             // Aggregates by calculating the 75th percentile of values of matched events
+	AggregateP90                             // Aggregates by calculating the 90th percentile of values of matched events
+	AggregateP95                             // Aggregates by calculating the 95th percentile of values of matched events
+	AggregateP99                             // Aggregates by calculating the 99th percentile of values of matched events
 )
 
+var aggregationMethodNames = []string{"count", "sum", "avg", "min", "max", "stddev", "p50", "p75", "p90", "p95", "p99"}
+
+// Name returns the name of the method used by the API and as the key in [AggregatedMetric.Extra], ie. "p95".
+func (m AggregationMethod) Name() string {
+	if m < 0 || int(m) >= len(aggregationMethodNames) {
+		return ""
+	}
+
+	return aggregationMethodNames[m]
+}
+
+// ParseAggregationMethod returns the method with the name, see [AggregationMethod.Name].
+func ParseAggregationMethod(name string) (AggregationMethod, error) {
+	for i, methodName := range aggregationMethodNames {
+		if methodName == name {
+			return AggregationMethod(i), nil
+		}
+	}
+
+	return AggregateCount, fmt.Errorf("unknown aggregation %q", name)
+}
+
 // AggregateDistinct provides advanced options to query the database.
 // Data can be filtered using the metric name or any combination of labels (including negation).
-// Additionally data can be grouped by a calculated key and aggregated using count, sum or average.
+// Additionally data can be grouped by a calculated key and aggregated using count, sum, average, min, max,
+// standard deviation or percentiles.
 // Example:
 //
 //	 func QueryExample() {
@@ -167,7 +337,8 @@ const (
 //	   }
 //	 }
 //
-// Results are sorted by highest value first.
+// Results are sorted by highest value first. Events are always read from the database, even with [WithRollups],
+// see [Kero.AggregateDistinctByLabel].
 func (k *Kero) AggregateDistinct(
 	metricName string,
 	groupBy GroupMetricBy,
@@ -176,35 +347,39 @@ func (k *Kero) AggregateDistinct(
 	start int64,
 	end int64,
 ) ([]AggregatedMetric, error) {
-	counts := make(map[string]int)
-	sums := make(map[string]float64)
+	return k.AggregateDistinctWithExtra(metricName, groupBy, labelFilters, aggregateBy, nil, start, end)
+}
 
-	metrics, err := k.Query(metricName, labelFilters, start, end)
-	if err != nil {
-		return []AggregatedMetric{}, err
+// AggregateDistinctByLabel is the same as [Kero.AggregateDistinct] grouping metrics by the label.
+// Unlike AggregateDistinct, results are read from rollups when enabled with [WithRollups] and the label and filters allow it.
+// Rollups are used only for count, sum and average.
+func (k *Kero) AggregateDistinctByLabel(
+	metricName string,
+	label string,
+	labelFilters MetricLabels,
+	aggregateBy AggregationMethod,
+	start int64,
+	end int64,
+) ([]AggregatedMetric, error) {
+	if rq, ok := k.rollupQueryFor(metricName, label, labelFilters); ok && aggregateBy <= AggregateAvg {
+		return k.aggregateRollups(rq, labelFilters, aggregateBy, start, end)
 	}
 
-	for _, metric := range metrics {
-		id := groupBy(metric)
-		if len(id) > 0 {
-			counts[id] += 1
-
-			if aggregateBy == AggregateSum || aggregateBy == AggregateAvg {
-				sums[id] += metric.Value
-			}
-		}
-	}
+	return k.AggregateDistinct(metricName, groupByLabel(label), labelFilters, aggregateBy, start, end)
+}
 
+// aggregatedMetrics turns counts and sums of values per group into results sorted by highest value first.
+func aggregatedMetrics(counts map[string]float64, sums map[string]float64, aggregateBy AggregationMethod) []AggregatedMetric {
 	allMetrics := []AggregatedMetric{}
-	for id, value := range counts {
+	for id, count := range counts {
 		var val float64
 		switch aggregateBy {
 		case AggregateCount:
-			val = float64(value)
+			val = count
 		case AggregateSum:
 			val = sums[id]
 		case AggregateAvg:
-			val = sums[id] / float64(value)
+			val = sums[id] / count
 		}
 
 		allMetrics = append(allMetrics, AggregatedMetric{
@@ -217,10 +392,11 @@ func (k *Kero) AggregateDistinct(
 		return allMetrics[i].Value > allMetrics[j].Value
 	})
 
-	return allMetrics, nil
+	return allMetrics
 }
 
 // CountDistinctByVisitor returns a number of unique visitors for which the matching events have been tracked.
+// Visitors are estimated when enabled with [WithApproximateVisitors].
 func (k *Kero) CountDistinctByVisitor(
 	metricName string,
 	groupBy GroupMetricBy,
@@ -228,22 +404,39 @@ func (k *Kero) CountDistinctByVisitor(
 	start int64,
 	end int64,
 ) ([]AggregatedMetric, error) {
-	// { "group1": {"visitor1": true, "visitor2": true, ...}, ... }
-	counts := make(map[string]map[string]bool)
-	metrics, err := k.Query(metricName, labelFilters, start, end)
-	if err != nil {
-		return []AggregatedMetric{}, err
+	if k.approximateVisitors {
+		sketches := make(map[string]*hyperLogLog)
+		for metric, err := range k.QueryIter(metricName, labelFilters, start, end) {
+			if err != nil {
+				return []AggregatedMetric{}, err
+			}
+
+			if visitorId, ok := metric.Labels[VisitorIdLabel]; ok {
+				if id := groupBy(metric); len(id) > 0 {
+					if _, exists := sketches[id]; !exists {
+						sketches[id] = newHyperLogLog()
+					}
+					sketches[id].Add(visitorId)
+				}
+			}
+		}
+
+		return estimatedVisitors(sketches), nil
 	}
 
-	for _, metric := range metrics {
+	// { "group1": {"visitor1": {}, "visitor2": {}, ...}, ... }
+	counts := make(map[string]map[string]struct{})
+	for metric, err := range k.QueryIter(metricName, labelFilters, start, end) {
+		if err != nil {
+			return []AggregatedMetric{}, err
+		}
+
 		if visitorId, ok := metric.Labels[VisitorIdLabel]; ok {
 			if id := groupBy(metric); len(id) > 0 {
 				if _, exists := counts[id]; !exists {
-					counts[id] = make(map[string]bool)
-				}
-				if _, tracked := counts[id][visitorId]; !tracked {
-					counts[id][visitorId] = true
+					counts[id] = make(map[string]struct{})
 				}
+				counts[id][visitorId] = struct{}{}
 			}
 		}
 	}
@@ -276,6 +469,14 @@ func (k *Kero) CountDistinctByVisitorAndLabel(
 		return k.CountDistinctByVisitor(metric, groupByRoute, labelFilters, start, end)
 	}
 
+	if k.approximateVisitors {
+		sketches, err := k.visitorSketches(metric, label, labelFilters, [][2]int64{{start, end}})
+		if err != nil {
+			return []AggregatedMetric{}, err
+		}
+		return estimatedVisitors(sketches[0]), nil
+	}
+
 	return k.CountDistinctByVisitor(metric, groupByLabel(label), labelFilters, start, end)
 }
 
@@ -341,6 +542,45 @@ const (
 	AggregateByYear                  = time.Hour * 24 * 31 * 12
 )
 
+// HistogramIntervals are the names of histogram subdivisions, as used by the `interval` param of the dashboard and the API.
+var HistogramIntervals = []struct {
+	Name     string
+	Interval time.Duration
+}{
+	{"hour", AggregateByHour},
+	{"day", AggregateByDay},
+	{"week", AggregateByWeek},
+	{"month", AggregateByMonth},
+	{"quarter", AggregateByQuarter},
+	{"year", AggregateByYear},
+}
+
+// maxHistogramSplits limits the number of subdivisions of an explicitly set interval.
+const maxHistogramSplits = 1000
+
+// parseHistogramInterval returns the interval of one of [HistogramIntervals], or 0 if the name is empty.
+func parseHistogramInterval(name string) (time.Duration, error) {
+	if len(name) == 0 {
+		return 0, nil
+	}
+	for _, interval := range HistogramIntervals {
+		if interval.Name == name {
+			return interval.Interval, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown interval %q", name)
+}
+
+// validateHistogramInterval checks that the timeframe doesn't have too many subdivisions of the interval.
+func validateHistogramInterval(interval time.Duration, start int64, end int64) error {
+	if interval > 0 && (end-start)/int64(interval.Seconds()) >= maxHistogramSplits {
+		return fmt.Errorf("interval is too short for the timeframe, more than %d subdivisions", maxHistogramSplits)
+	}
+
+	return nil
+}
+
 func selectTimeUnitForTimeframe(start, end int64) time.Duration {
 	startTime := time.Unix(start, 0)
 	endTime := time.Unix(end, 0)
@@ -363,14 +603,131 @@ func selectTimeUnitForTimeframe(start, end int64) time.Duration {
 	return AggregateByMonth
 }
 
-func timeSplits(unit time.Duration, start int64, end int64) [][2]int64 {
+// forEachSampleInSplits goes through matching samples within the time splits in a single pass, calling fn
+// with labels of the series, index of the split and the number of samples of the series within the split.
+func (k *Kero) forEachSampleInSplits(metric string, labelFilters MetricLabels, splits [][2]int64, fn func(series plabels.Labels, split int, samples int)) error {
+	if len(splits) == 0 {
+		return nil
+	}
+
+	q, err := k.db.Querier(dbTimeRange(splits[0][0], splits[len(splits)-1][1]-1))
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	ss := q.Select(context.Background(), false, nil, queryMatchers(metric, labelFilters)...)
+	var it chunkenc.Iterator
+	for ss.Next() {
+		series := ss.At()
+		lbls := series.Labels()
+		it = series.Iterator(it)
+
+		// samples of a series are sorted by time, so they're counted until passing the end of the current split
+		split, samples := -1, 0
+		nextSplitStart := int64(math.MinInt64)
+		for it.Next() == chunkenc.ValFloat {
+			ts := it.AtT()
+			if split >= 0 && ts < nextSplitStart {
+				samples += 1
+				continue
+			}
+
+			if samples > 0 {
+				fn(lbls, split, samples)
+			}
+			split, samples = splitIndex(splits, ts), 0
+			if split < 0 {
+				continue
+			}
+
+			samples = 1
+			nextSplitStart = math.MaxInt64
+			if split < len(splits)-1 {
+				nextSplitStart = splits[split+1][0] * 1000
+			}
+		}
+		if samples > 0 {
+			fn(lbls, split, samples)
+		}
+
+		if err := it.Err(); err != nil {
+			return err
+		}
+	}
+
+	return ss.Err()
+}
+
+// splitIndex finds the time split, as created by timeSplits, containing the timestamp in milliseconds.
+// Each split starts at its start time and ends just before its end time, which is the start of the next split.
+// Returns -1 if the timestamp is outside of all splits.
+func splitIndex(splits [][2]int64, tsMillis int64) int {
+	i := sort.Search(len(splits), func(i int) bool { return splits[i][0]*1000 > tsMillis }) - 1
+	if i < 0 || tsMillis >= splits[i][1]*1000 {
+		return -1
+	}
+
+	return i
+}
+
+// histogramSplits divides the timeframe into subdivisions of the interval in the location,
+// choosing the interval based on the duration of the timeframe if it's 0.
+func (k *Kero) histogramSplits(interval time.Duration, start int64, end int64, loc *time.Location) [][2]int64 {
+	if interval == 0 {
+		interval = selectTimeUnitForTimeframe(start, end)
+	}
+
+	return timeSplits(interval, start, end, loc, k.weekStart)
+}
+
+// timeSplits divides the timeframe into calendar periods of the unit in the location, see [calendarPeriod].
+// Each split is a range of seconds with an exclusive end. The first split starts at start time, and the last one
+// ends right after the end of the timeframe, which is inclusive, so that events after it aren't counted.
+func timeSplits(unit time.Duration, start int64, end int64, loc *time.Location, weekStart time.Weekday) [][2]int64 {
 	splits := [][2]int64{}
-	increment := int64(unit.Seconds())
 
-	for start < end {
-		splits = append(splits, [2]int64{start, start + increment})
-		start += increment
+	for t := time.Unix(start, 0).In(loc); t.Unix() < end; {
+		_, next := calendarPeriod(t, unit, weekStart)
+		splits = append(splits, [2]int64{t.Unix(), next.Unix()})
+		t = next
+	}
+	if len(splits) > 0 {
+		splits[len(splits)-1][1] = end + 1
 	}
 
 	return splits
 }
+
+// calendarPeriod returns the start of the period of the unit containing the time and the start of the next period.
+// Days start at midnight, weeks on weekStart, months, quarters and years on their first day, while other units are
+// multiples of the unit since the start of the hour. Days are added as calendar days, so that periods start at midnight
+// even when a DST change happens in between.
+func calendarPeriod(t time.Time, unit time.Duration, weekStart time.Weekday) (time.Time, time.Time) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	switch unit {
+	case AggregateByDay:
+		return day, day.AddDate(0, 0, 1)
+	case AggregateByWeek:
+		week := day.AddDate(0, 0, -int((7+day.Weekday()-weekStart)%7))
+		return week, week.AddDate(0, 0, 7)
+	case AggregateByMonth:
+		month := day.AddDate(0, 0, -day.Day()+1)
+		return month, month.AddDate(0, 1, 0)
+	case AggregateByQuarter:
+		quarter := time.Date(t.Year(), t.Month()-(t.Month()-1)%3, 1, 0, 0, 0, 0, t.Location())
+		return quarter, quarter.AddDate(0, 3, 0)
+	case AggregateByYear:
+		year := time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+		return year, year.AddDate(1, 0, 0)
+	default:
+		// the hour is taken from the local time, as some timezones are offset by 30 or 45 minutes
+		hour := t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+		if unit <= 0 {
+			unit = AggregateByHour
+		}
+		period := hour.Add(t.Sub(hour).Truncate(unit))
+		return period, period.Add(unit)
+	}
+}
@@ -1,8 +1,15 @@
 package kero
 
 import (
+	"context"
+	"fmt"
 	"testing"
 	"time"
+
+	"github.com/go-kit/log"
+	plabels "github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
 )
 
 func TestSelectTimeUnitForTimeframe(t *testing.T) {
@@ -57,3 +64,349 @@ func TestSelectTimeUnitForTimeframe(t *testing.T) {
 		}
 	}
 }
+
+func TestTimeSplitsAcrossDST(t *testing.T) {
+	loc, _ := time.LoadLocation("Europe/Berlin")
+
+	// clocks moved forward on March 31 2024 and back on October 27 2024
+	for _, day := range []time.Time{
+		time.Date(2024, time.March, 31, 0, 0, 0, 0, loc),
+		time.Date(2024, time.October, 27, 0, 0, 0, 0, loc),
+	} {
+		start := day.AddDate(0, 0, -3)
+		end := day.AddDate(0, 0, 3).Unix() - 1
+		splits := timeSplits(AggregateByDay, start.Unix(), end, loc, time.Monday)
+		if len(splits) != 6 {
+			t.Fatal("expected 6 days, got", len(splits))
+		}
+		for i, split := range splits {
+			if midnight := start.AddDate(0, 0, i); split[0] != midnight.Unix() {
+				t.Error("expected split to start at", midnight, "got", time.Unix(split[0], 0).In(loc))
+			}
+		}
+
+		hours := timeSplits(AggregateByHour, day.Unix(), day.AddDate(0, 0, 1).Unix()-1, loc, time.Monday)
+		if len(hours) != 23 && len(hours) != 25 {
+			t.Error("expected 23 or 25 hours on", day, "got", len(hours))
+		}
+	}
+}
+
+func TestQueryIter(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()))
+	defer k.Close()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	trackPageViews(t, k, start, []testPageView{
+		{"a", "/", 0},
+		{"a", "/pricing", time.Minute},
+		{"b", "/", 2 * time.Minute},
+		{"b", "/", 3 * time.Minute},
+	})
+	end := time.Now().Unix()
+
+	seen := 0
+	for m, err := range k.QueryIter(HttpReqMetricName, MetricLabels{HttpPathLabel: "/"}, start.Unix(), end) {
+		if err != nil {
+			t.Fatal("failed to query", err)
+		}
+		if m.Name != HttpReqMetricName || m.Labels[HttpPathLabel] != "/" {
+			t.Error("unexpected metric", m)
+		}
+		seen += 1
+	}
+	if seen != 3 {
+		t.Error("expected 3 metrics, got", seen)
+	}
+
+	for range k.QueryIter(HttpReqMetricName, nil, start.Unix(), end) {
+		break
+	}
+
+	// b visited / twice, so both events are in the same series
+	metrics, err := k.Query(HttpReqMetricName, MetricLabels{VisitorIdLabel: "b"}, start.Unix(), end)
+	if err != nil || len(metrics) != 2 {
+		t.Fatal("expected 2 metrics, got", metrics, err)
+	}
+	metrics[0].Labels[HttpPathLabel] = "/changed"
+	if metrics[1].Labels[HttpPathLabel] != "/" {
+		t.Error("expected labels of queried metrics not to be shared")
+	}
+
+	visitors, err := k.CountVisitors(HttpReqMetricName, nil, start.Unix(), end)
+	if err != nil || visitors != 2 {
+		t.Error("expected 2 visitors, got", visitors, err)
+	}
+
+	byPath, err := k.CountDistinctByVisitorAndLabel(HttpReqMetricName, HttpPathLabel, nil, start.Unix(), end)
+	if err != nil || len(byPath) != 2 || byPath[0].Label != "/" || byPath[0].Value != 2 {
+		t.Error("unexpected visitors by path", byPath, err)
+	}
+
+	views, err := k.AggregateDistinct(HttpReqMetricName, groupByLabel(HttpPathLabel), nil, AggregateCount, start.Unix(), end)
+	if err != nil || len(views) != 2 || views[0].Label != "/" || views[0].Value != 3 {
+		t.Error("unexpected views by path", views, err)
+	}
+}
+
+func TestHistograms(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()))
+	defer k.Close()
+
+	// whole hours so that events fall exactly on the boundaries of hourly splits
+	start := time.Now().Add(-5 * time.Hour).Truncate(time.Hour)
+	end := start.Add(3 * time.Hour)
+	trackPageViews(t, k, start, []testPageView{
+		{"a", "/", 0},
+		{"b", "/", 30 * time.Minute},
+		{"a", "/", time.Hour - time.Millisecond},
+		{"a", "/", time.Hour},
+		{"c", "/", 3 * time.Hour},
+		// outside of the timeframe
+		{"d", "/", 3*time.Hour + time.Second},
+	})
+
+	views := k.CountHistogram(HttpReqMetricName, start.Unix(), end.Unix())
+	visitors := k.VisitorsHistogram(HttpReqMetricName, nil, start.Unix(), end.Unix())
+	wantViews := []int64{3, 1, 1}
+	wantVisitors := []int64{2, 1, 1}
+	if len(views) != len(wantViews) || len(visitors) != len(wantVisitors) {
+		t.Fatal("expected 3 hourly splits, got", views, visitors)
+	}
+	for i := range wantViews {
+		if views[i][0] != start.Add(time.Duration(i)*time.Hour).Unix() {
+			t.Error("split", i, "starts at", views[i][0])
+		}
+		if views[i][1] != wantViews[i] {
+			t.Error("split", i, "expected", wantViews[i], "views, got", views[i][1])
+		}
+		if visitors[i][1] != wantVisitors[i] {
+			t.Error("split", i, "expected", wantVisitors[i], "visitors, got", visitors[i][1])
+		}
+	}
+}
+
+func TestCalendarTimeSplits(t *testing.T) {
+	loc, _ := time.LoadLocation("Europe/Zurich")
+	date := func(year int, month time.Month, day int) int64 {
+		return time.Date(year, month, day, 0, 0, 0, 0, loc).Unix()
+	}
+
+	cases := []struct {
+		unit       time.Duration
+		weekStart  time.Weekday
+		start, end int64
+		wants      []int64
+	}{
+		// months of different lengths, starting mid-month
+		{AggregateByMonth, time.Monday, date(2024, time.January, 15), date(2024, time.April, 1) - 1,
+			[]int64{date(2024, time.January, 15), date(2024, time.February, 1), date(2024, time.March, 1)}},
+		// ISO weeks, with Jan 3 2024 being a Wednesday
+		{AggregateByWeek, time.Monday, date(2024, time.January, 3), date(2024, time.January, 17),
+			[]int64{date(2024, time.January, 3), date(2024, time.January, 8), date(2024, time.January, 15)}},
+		{AggregateByWeek, time.Sunday, date(2024, time.January, 3), date(2024, time.January, 17),
+			[]int64{date(2024, time.January, 3), date(2024, time.January, 7), date(2024, time.January, 14)}},
+		{AggregateByQuarter, time.Monday, date(2023, time.November, 20), date(2024, time.May, 1),
+			[]int64{date(2023, time.November, 20), date(2024, time.January, 1), date(2024, time.April, 1)}},
+		{AggregateByYear, time.Monday, date(2022, time.June, 1), date(2024, time.January, 1),
+			[]int64{date(2022, time.June, 1), date(2023, time.January, 1)}},
+	}
+
+	for i, testCase := range cases {
+		splits := timeSplits(testCase.unit, testCase.start, testCase.end, loc, testCase.weekStart)
+		if len(splits) != len(testCase.wants) {
+			t.Error("case", i, "expected", len(testCase.wants), "splits, got", len(splits))
+			continue
+		}
+		for j, split := range splits {
+			if split[0] != testCase.wants[j] {
+				t.Error("case", i, "split", j, "expected to start at", time.Unix(testCase.wants[j], 0).In(loc), "got", time.Unix(split[0], 0).In(loc))
+			}
+			if j > 0 && splits[j-1][1] != split[0] {
+				t.Error("case", i, "split", j, "doesn't start at the end of the previous one")
+			}
+		}
+	}
+}
+
+func TestHistogramInterval(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()), WithTimezone(time.UTC), WithWeekStart(time.Sunday))
+	defer k.Close()
+
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	histogram := k.CountHistogramWithInterval(HttpReqMetricName, nil, AggregateByWeek, start.Unix(), start.AddDate(0, 0, 14).Unix())
+	// Jan 1 2024 is a Monday, so the first week is cut short
+	if len(histogram) != 3 || histogram[1][0] != start.AddDate(0, 0, 6).Unix() {
+		t.Error("expected weeks starting on Sunday, got", histogram)
+	}
+
+	if _, err := New(WithDB(t.TempDir()), WithWeekStart(7)); err == nil {
+		t.Error("should fail with invalid week start")
+	}
+}
+
+func TestHistogramEndsMidPeriod(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()), WithTimezone(time.UTC))
+	defer k.Close()
+
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -3)
+	for _, at := range []time.Duration{
+		time.Hour,
+		35 * time.Hour,
+		36*time.Hour + time.Second,
+		48*time.Hour + 500*time.Millisecond,
+	} {
+		k.trackAt(HttpReqMetricName, MetricLabels{VisitorIdLabel: "a"}, 1, day.Add(at))
+	}
+	k.Flush()
+
+	cases := []struct {
+		end   time.Time
+		wants []int64
+	}{
+		// ends at noon of the second day
+		{day.Add(36 * time.Hour), []int64{1, 1}},
+		// ends just before the third day, excluding the event half a second later
+		{day.Add(48*time.Hour - time.Second), []int64{1, 2}},
+	}
+	for _, testCase := range cases {
+		start, end := day.Unix(), testCase.end.Unix()
+		views := k.CountHistogramWithInterval(HttpReqMetricName, nil, AggregateByDay, start, end)
+		visitors := k.VisitorsHistogramWithInterval(HttpReqMetricName, nil, AggregateByDay, start, end)
+		if len(views) != len(testCase.wants) || len(visitors) != len(testCase.wants) {
+			t.Error("expected", len(testCase.wants), "days until", testCase.end, "got", views, visitors)
+			continue
+		}
+
+		total := int64(0)
+		for i, want := range testCase.wants {
+			if views[i][1] != want || visitors[i][1] != 1 {
+				t.Error("day", i, "until", testCase.end, "expected", want, "views of 1 visitor, got", views[i][1], visitors[i][1])
+			}
+			total += views[i][1]
+		}
+		if count := k.Count(HttpReqMetricName, start, end); int64(count) != total {
+			t.Error("expected histogram until", testCase.end, "to add up to", count, "got", total)
+		}
+	}
+}
+
+// createBenchmarkDB writes page views of 1000 visitors to 50 paths, spread evenly over the past year,
+// into monthly blocks as they would be after compaction.
+func createBenchmarkDB(b *testing.B, events int) (*Kero, int64, int64) {
+	dbPath := b.TempDir()
+	if err := writeDBFormat(dbPath); err != nil {
+		b.Fatal("failed to create db", err)
+	}
+
+	ctx := context.Background()
+	end := time.Now()
+	start := end.AddDate(-1, 0, 0)
+	step := end.Sub(start).Milliseconds() / int64(events)
+	blockSize := (31 * 24 * time.Hour).Milliseconds()
+
+	var w *tsdb.BlockWriter
+	var app storage.Appender
+	flush := func() {
+		if err := app.Commit(); err != nil {
+			b.Fatal("failed to commit", err)
+		}
+		if _, err := w.Flush(ctx); err != nil {
+			b.Fatal("failed to write block", err)
+		}
+		w.Close()
+	}
+
+	blockStart := int64(0)
+	for i := 0; i < events; i++ {
+		ts := start.UnixMilli() + int64(i)*step
+		if w == nil || ts-blockStart >= blockSize {
+			if w != nil {
+				flush()
+			}
+
+			var err error
+			if w, err = tsdb.NewBlockWriter(log.NewNopLogger(), dbPath, blockSize); err != nil {
+				b.Fatal("failed to create block writer", err)
+			}
+			app = w.Appender(ctx)
+			blockStart = ts
+		}
+
+		lbls := plabels.FromStrings(
+			plabels.MetricName, HttpReqMetricName,
+			HttpPathLabel, fmt.Sprintf("/page/%d", i%50),
+			VisitorIdLabel, fmt.Sprintf("visitor-%d", i%1000),
+		)
+		if _, err := app.Append(0, lbls, ts, 1); err != nil {
+			b.Fatal("failed to append", err)
+		}
+	}
+	flush()
+
+	k, err := New(WithDB(dbPath), WithRetention(2*365*24*time.Hour))
+	if err != nil {
+		b.Fatal("failed to create kero", err)
+	}
+
+	return k, start.Unix(), end.Unix()
+}
+
+// countHistogramPerSplit is the previous implementation of CountHistogram, querying each split separately.
+func (k *Kero) countHistogramPerSplit(metric string, start int64, end int64) [][2]int64 {
+	timeframes := timeSplits(selectTimeUnitForTimeframe(start, end), start, end, time.Local, time.Monday)
+	counts := make([][2]int64, len(timeframes))
+	for i, timeframe := range timeframes {
+		counts[i] = [2]int64{timeframe[0], int64(k.Count(metric, timeframe[0], timeframe[1]))}
+	}
+
+	return counts
+}
+
+// visitorsHistogramPerSplit is the previous implementation of VisitorsHistogram, querying each split separately.
+func (k *Kero) visitorsHistogramPerSplit(metric string, start int64, end int64) [][2]int64 {
+	timeframes := timeSplits(selectTimeUnitForTimeframe(start, end), start, end, time.Local, time.Monday)
+	counts := make([][2]int64, len(timeframes))
+	for i, timeframe := range timeframes {
+		count, _ := k.CountVisitors(metric, nil, timeframe[0], timeframe[1])
+		counts[i] = [2]int64{timeframe[0], int64(count)}
+	}
+
+	return counts
+}
+
+func BenchmarkHistograms(b *testing.B) {
+	k, start, end := createBenchmarkDB(b, 1_000_000)
+	defer k.Close()
+
+	timeframes := []struct {
+		name  string
+		start int64
+	}{
+		{"30d", end - 30*24*60*60},
+		{"12m", start},
+	}
+
+	for _, tf := range timeframes {
+		b.Run("CountHistogram/"+tf.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				k.CountHistogram(HttpReqMetricName, tf.start, end)
+			}
+		})
+		b.Run("CountHistogramPerSplit/"+tf.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				k.countHistogramPerSplit(HttpReqMetricName, tf.start, end)
+			}
+		})
+		b.Run("VisitorsHistogram/"+tf.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				k.VisitorsHistogram(HttpReqMetricName, nil, tf.start, end)
+			}
+		})
+		b.Run("VisitorsHistogramPerSplit/"+tf.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				k.visitorsHistogramPerSplit(HttpReqMetricName, tf.start, end)
+			}
+		})
+	}
+}
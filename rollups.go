@@ -0,0 +1,610 @@
+package kero
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+const rollupsDirName = "rollups"
+const rollupWatermarkFileName = "watermark"
+
+// Labels of rollup series. Each series holds either the number of events or the sum of their values
+// for one value of a rolled-up label, or for all events if $rollup_dim is missing.
+const rollupResolutionLabel = "$rollup"
+const rollupAggLabel = "$rollup_agg"
+const rollupDimLabel = "$rollup_dim"
+const rollupValueLabel = "$rollup_value"
+const rollupBotLabel = "$rollup_bot"
+
+const (
+	rollupHourly = "1h"
+	rollupDaily  = "1d"
+	rollupRaw    = "" // segment read from raw events
+)
+
+const (
+	rollupAggCount = "count"
+	rollupAggSum   = "sum"
+)
+
+const hourMillis = int64(time.Hour / time.Millisecond)
+const dayMillis = 24 * hourMillis
+
+// hours are rolled up only once they ended at least rollupDelay ago, leaving time for queued events to be written
+const rollupDelay = 5 * time.Minute
+const rollupInterval = 5 * time.Minute
+
+// DefaultRollupDimensions are the labels rolled up when [WithRollups] is used without any dimensions.
+var DefaultRollupDimensions = []string{
+	HttpPathLabel,
+	ReferrerDomainLabel,
+	UTMSourceLabel,
+	UTMMediumLabel,
+	UTMCampaignLabel,
+	CountryLabel,
+	BrowserNameLabel,
+	BrowserOSLabel,
+	BrowserFormFactorLabel,
+	HttpStatusClassLabel,
+	HttpStatusCodeLabel,
+}
+
+type rollupStore struct {
+	dir           string
+	retention     time.Duration
+	db            *tsdb.DB
+	dimensions    []string
+	watermark     atomic.Int64 // rollups include all events before the watermark, in milliseconds
+	watermarkPath string
+	lock          sync.Mutex // held while writing rollups
+	stop          chan struct{}
+	done          chan struct{}
+}
+
+func (k *Kero) openRollups() error {
+	dir := filepath.Join(k.dbPath, rollupsDirName)
+	opts := tsdb.DefaultOptions()
+	opts.RetentionDuration = k.rollupRetention.Milliseconds()
+	// rollups are sparse and written in hourly batches, so bigger blocks are used than for raw events
+	opts.MinBlockDuration = dayMillis
+	opts.MaxBlockDuration = 31 * dayMillis
+
+	db, err := tsdb.Open(dir, nil, nil, opts, nil)
+	if err != nil {
+		return err
+	}
+
+	r := &rollupStore{
+		dir:           dir,
+		retention:     k.rollupRetention,
+		db:            db,
+		dimensions:    k.rollupDimensions,
+		watermarkPath: filepath.Join(dir, rollupWatermarkFileName),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	watermark, err := r.loadWatermark()
+	if err != nil {
+		db.Close()
+		return err
+	}
+	if watermark == 0 {
+		watermark = k.oldestEventDay(time.Now())
+	}
+	r.watermark.Store(watermark)
+
+	k.rollups = r
+	go k.runRollups()
+
+	return nil
+}
+
+func (k *Kero) closeRollups() error {
+	if k.rollups == nil {
+		return nil
+	}
+
+	close(k.rollups.stop)
+	<-k.rollups.done
+	return k.rollups.db.Close()
+}
+
+func (r *rollupStore) loadWatermark() (int64, error) {
+	data, err := os.ReadFile(r.watermarkPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	watermark, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rollup watermark: %w", err)
+	}
+
+	return watermark, nil
+}
+
+func (r *rollupStore) saveWatermark(watermark int64) error {
+	tmpPath := r.watermarkPath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strconv.FormatInt(watermark, 10)+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, r.watermarkPath); err != nil {
+		return err
+	}
+
+	r.watermark.Store(watermark)
+	return nil
+}
+
+// oldestEventDay returns the start of the UTC day of the oldest event in the database, or of today if it's empty.
+func (k *Kero) oldestEventDay(now time.Time) int64 {
+	oldest := k.db.Head().MinTime()
+	for _, block := range k.db.Blocks() {
+		oldest = min(oldest, block.Meta().MinTime)
+	}
+	if oldest == math.MaxInt64 || oldest > now.UnixMilli() {
+		oldest = now.UnixMilli()
+	}
+
+	return oldest - oldest%dayMillis
+}
+
+func (k *Kero) runRollups() {
+	defer close(k.rollups.done)
+
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := k.rollupPending(time.Now()); err != nil {
+			fmt.Println("[kero] error writing rollups", err)
+		}
+
+		select {
+		case <-k.rollups.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rollupPending writes rollups of all hours between the watermark and now, and of days completed by those hours.
+func (k *Kero) rollupPending(now time.Time) error {
+	r := k.rollups
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	last := now.Add(-rollupDelay).UnixMilli()
+	last -= last % hourMillis
+	for hour := r.watermark.Load(); hour < last; hour += hourMillis {
+		select {
+		case <-r.stop:
+			return nil
+		default:
+		}
+
+		if err := k.rollupHour(hour); err != nil {
+			return err
+		}
+		if (hour+hourMillis)%dayMillis == 0 {
+			if err := r.rollupDay(hour + hourMillis - dayMillis); err != nil {
+				return err
+			}
+		}
+		if err := r.saveWatermark(hour + hourMillis); err != nil {
+			return err
+		}
+	}
+
+	return r.removeExpiredSketches(now)
+}
+
+type rollupKey struct {
+	metric    string
+	dimension string
+	value     string
+	bot       bool
+}
+
+type rollupValues struct {
+	count    float64
+	sum      float64
+	visitors *hyperLogLog // nil if none of the events had a visitor ID
+}
+
+// rollupHour aggregates raw events within the hour starting at the timestamp.
+func (k *Kero) rollupHour(hour int64) error {
+	q, err := k.db.Querier(hour, hour+hourMillis-1)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	aggs := make(map[rollupKey]*rollupValues)
+	add := func(key rollupKey, count, sum float64, visitorId string, visitorHash uint64) {
+		values, exists := aggs[key]
+		if !exists {
+			values = &rollupValues{}
+			aggs[key] = values
+		}
+		values.count += count
+		values.sum += sum
+		if len(visitorId) > 0 {
+			if values.visitors == nil {
+				values.visitors = newHyperLogLog()
+			}
+			values.visitors.AddHash(visitorHash)
+		}
+	}
+
+	ss := q.Select(context.Background(), false, nil, queryMatchers("", nil)...)
+	var it chunkenc.Iterator
+	for ss.Next() {
+		series := ss.At()
+		lbls := series.Labels()
+
+		count, sum := 0.0, 0.0
+		it = series.Iterator(it)
+		for it.Next() == chunkenc.ValFloat {
+			_, v := it.At()
+			count += 1
+			sum += v
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+		if count == 0 {
+			continue
+		}
+
+		metric := lbls.Get(labels.MetricName)
+		bot := lbls.Get(BrowserFormFactorLabel) == FormFactorBot
+		visitorId := lbls.Get(VisitorIdLabel)
+		visitorHash := hllHash(visitorId)
+		add(rollupKey{metric: metric, bot: bot}, count, sum, visitorId, visitorHash)
+		for _, dim := range k.rollups.dimensions {
+			if value := lbls.Get(dim); len(value) > 0 {
+				add(rollupKey{metric, dim, value, bot}, count, sum, visitorId, visitorHash)
+			}
+		}
+	}
+	if err := ss.Err(); err != nil {
+		return err
+	}
+
+	sketches := make(map[rollupKey]*hyperLogLog)
+	for key, values := range aggs {
+		if values.visitors != nil {
+			sketches[key] = values.visitors
+		}
+	}
+	if err := k.rollups.writeSketches(rollupHourly, hour, sketches); err != nil {
+		return err
+	}
+
+	return k.rollups.write(rollupHourly, hour+hourMillis-1, aggs)
+}
+
+// rollupDay sums hourly rollups of the UTC day starting at the timestamp.
+func (r *rollupStore) rollupDay(day int64) error {
+	q, err := r.db.Querier(day, day+dayMillis-1)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+
+	aggs := make(map[rollupKey]*rollupValues)
+	ss := q.Select(context.Background(), false, nil, labels.MustNewMatcher(labels.MatchEqual, rollupResolutionLabel, rollupHourly))
+	var it chunkenc.Iterator
+	for ss.Next() {
+		series := ss.At()
+		lbls := series.Labels()
+		key := rollupKey{
+			metric:    lbls.Get(labels.MetricName),
+			dimension: lbls.Get(rollupDimLabel),
+			value:     lbls.Get(rollupValueLabel),
+			bot:       lbls.Get(rollupBotLabel) == "1",
+		}
+		values, exists := aggs[key]
+		if !exists {
+			values = &rollupValues{}
+			aggs[key] = values
+		}
+
+		isSum := lbls.Get(rollupAggLabel) == rollupAggSum
+		it = series.Iterator(it)
+		for it.Next() == chunkenc.ValFloat {
+			_, v := it.At()
+			if isSum {
+				values.sum += v
+			} else {
+				values.count += v
+			}
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+	}
+	if err := ss.Err(); err != nil {
+		return err
+	}
+
+	if err := r.rollupDaySketches(day); err != nil {
+		return err
+	}
+
+	return r.write(rollupDaily, day+dayMillis-1, aggs)
+}
+
+// write appends count and sum series of the aggregations at the timestamp, the last millisecond of the rolled-up period.
+func (r *rollupStore) write(resolution string, ts int64, aggs map[rollupKey]*rollupValues) error {
+	if len(aggs) == 0 {
+		return nil
+	}
+
+	app := r.db.Appender(context.Background())
+	builder := labels.NewBuilder(labels.EmptyLabels())
+	for key, values := range aggs {
+		builder.Reset(labels.EmptyLabels())
+		builder.Set(labels.MetricName, key.metric)
+		builder.Set(rollupResolutionLabel, resolution)
+		builder.Set(rollupDimLabel, key.dimension)
+		builder.Set(rollupValueLabel, key.value)
+		if key.bot {
+			builder.Set(rollupBotLabel, "1")
+		}
+
+		builder.Set(rollupAggLabel, rollupAggCount)
+		if err := appendRollup(app, builder.Labels(), ts, values.count); err != nil {
+			app.Rollback()
+			return err
+		}
+		builder.Set(rollupAggLabel, rollupAggSum)
+		if err := appendRollup(app, builder.Labels(), ts, values.sum); err != nil {
+			app.Rollback()
+			return err
+		}
+	}
+
+	return app.Commit()
+}
+
+// appendRollup appends the sample, skipping it if the period has already been rolled up before the watermark was saved.
+func appendRollup(app storage.Appender, lbls labels.Labels, ts int64, value float64) error {
+	_, err := app.Append(0, lbls, ts, value)
+	if errors.Is(err, storage.ErrDuplicateSampleForTimestamp) || errors.Is(err, storage.ErrOutOfOrderSample) {
+		return nil
+	}
+	return err
+}
+
+// rollupQuery describes rollup series able to answer a query, see [Kero.rollupQueryFor].
+type rollupQuery struct {
+	metric    string
+	dimension string // label whose values are aggregated, empty for totals
+	value     string // if set, only events with this value of the dimension are included
+	bot       string // "" for all events, "0" for excluding bots and "1" for bots only
+}
+
+// rollupQueryFor checks whether events of the metric matching the filters, optionally grouped by the label, can be read
+// from rollups. Supported filters are excluding or selecting bots and, if not grouping, equality of a rolled-up label.
+func (k *Kero) rollupQueryFor(metric string, groupBy string, labelFilters MetricLabels) (rollupQuery, bool) {
+	rq := rollupQuery{metric: metric}
+	if k.rollups == nil || len(metric) == 0 {
+		return rq, false
+	}
+
+	for key, value := range labelFilters {
+		switch {
+		case key == BrowserFormFactorLabel+"!=" && value == FormFactorBot:
+			rq.bot = "0"
+		case key == BrowserFormFactorLabel && value == FormFactorBot:
+			rq.bot = "1"
+		case len(groupBy) == 0 && len(rq.dimension) == 0 && k.isRollupDimension(key):
+			rq.dimension, rq.value = key, value
+		default:
+			return rq, false
+		}
+	}
+
+	if len(groupBy) > 0 {
+		if !k.isRollupDimension(groupBy) {
+			return rq, false
+		}
+		rq.dimension = groupBy
+	}
+
+	return rq, true
+}
+
+func (k *Kero) isRollupDimension(label string) bool {
+	for _, dim := range k.rollups.dimensions {
+		if dim == label {
+			return true
+		}
+	}
+	return false
+}
+
+func (rq rollupQuery) matchers(resolution string) []*labels.Matcher {
+	matchers := []*labels.Matcher{
+		labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, rq.metric),
+		labels.MustNewMatcher(labels.MatchEqual, rollupResolutionLabel, resolution),
+		labels.MustNewMatcher(labels.MatchEqual, rollupDimLabel, rq.dimension),
+	}
+	if len(rq.value) > 0 {
+		matchers = append(matchers, labels.MustNewMatcher(labels.MatchEqual, rollupValueLabel, rq.value))
+	}
+	switch rq.bot {
+	case "0":
+		matchers = append(matchers, labels.MustNewMatcher(labels.MatchEqual, rollupBotLabel, ""))
+	case "1":
+		matchers = append(matchers, labels.MustNewMatcher(labels.MatchEqual, rollupBotLabel, "1"))
+	}
+
+	return matchers
+}
+
+// rollupSegment is a part of a queried timeframe, in milliseconds with exclusive end, read at the same resolution.
+type rollupSegment struct {
+	start      int64
+	end        int64
+	resolution string
+}
+
+// appendRollupSegments splits the timeframe into whole UTC days and hours before the watermark, read from
+// rollups, and the rest read from raw events. Adjacent segments of the same resolution are merged.
+func appendRollupSegments(segments []rollupSegment, start, end, watermark int64) []rollupSegment {
+	add := func(start, end int64, resolution string) {
+		if start >= end {
+			return
+		}
+		if n := len(segments); n > 0 && segments[n-1].resolution == resolution && segments[n-1].end == start {
+			segments[n-1].end = end
+			return
+		}
+		segments = append(segments, rollupSegment{start, end, resolution})
+	}
+
+	covered := min(end, watermark)
+	t := start
+	for t < covered {
+		switch {
+		case t%dayMillis == 0 && t+dayMillis <= covered:
+			add(t, t+dayMillis, rollupDaily)
+			t += dayMillis
+		case t%hourMillis == 0 && t+hourMillis <= covered:
+			add(t, t+hourMillis, rollupHourly)
+			t += hourMillis
+		default:
+			next := min(covered, t-t%hourMillis+hourMillis)
+			add(t, next, rollupRaw)
+			t = next
+		}
+	}
+	add(t, end, rollupRaw)
+
+	return segments
+}
+
+// scanRollups calls fn for the value of the queried dimension with the number and the sum of events at the timestamp,
+// reading rollups or raw events, matching the filters, depending on the resolution of each segment.
+func (k *Kero) scanRollups(rq rollupQuery, labelFilters MetricLabels, segments []rollupSegment, fn func(value string, ts int64, count, sum float64)) error {
+	var it chunkenc.Iterator
+	for _, segment := range segments {
+		db, matchers := k.db, queryMatchers(rq.metric, labelFilters)
+		if segment.resolution != rollupRaw {
+			db, matchers = k.rollups.db, rq.matchers(segment.resolution)
+		}
+
+		q, err := db.Querier(segment.start, segment.end-1)
+		if err != nil {
+			return err
+		}
+
+		ss := q.Select(context.Background(), false, nil, matchers...)
+		for ss.Next() {
+			series := ss.At()
+			lbls := series.Labels()
+
+			var value string
+			isSum := false
+			if segment.resolution == rollupRaw {
+				if len(rq.dimension) > 0 {
+					if value = lbls.Get(rq.dimension); len(value) == 0 {
+						continue
+					}
+				}
+			} else {
+				value = lbls.Get(rollupValueLabel)
+				isSum = lbls.Get(rollupAggLabel) == rollupAggSum
+			}
+
+			it = series.Iterator(it)
+			for it.Next() == chunkenc.ValFloat {
+				ts, v := it.At()
+				switch {
+				case segment.resolution == rollupRaw:
+					fn(value, ts, 1, v)
+				case isSum:
+					fn(value, ts, 0, v)
+				default:
+					fn(value, ts, v, 0)
+				}
+			}
+			if err := it.Err(); err != nil {
+				q.Close()
+				return err
+			}
+		}
+
+		err = ss.Err()
+		q.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// aggregateRollups is [Kero.AggregateDistinct] grouped by the dimension of the query, reading rollups where possible.
+func (k *Kero) aggregateRollups(rq rollupQuery, labelFilters MetricLabels, aggregateBy AggregationMethod, start, end int64) ([]AggregatedMetric, error) {
+	startMs, endMs := dbTimeRange(start, end)
+	segments := appendRollupSegments(nil, startMs, endMs+1, k.rollups.watermark.Load())
+
+	counts := make(map[string]float64)
+	sums := make(map[string]float64)
+	err := k.scanRollups(rq, labelFilters, segments, func(value string, _ int64, count, sum float64) {
+		counts[value] += count
+		sums[value] += sum
+	})
+	if err != nil {
+		return []AggregatedMetric{}, err
+	}
+
+	return aggregatedMetrics(counts, sums, aggregateBy), nil
+}
+
+// countRollups counts events per time split, reading rollups where possible.
+func (k *Kero) countRollups(rq rollupQuery, labelFilters MetricLabels, splits [][2]int64, counts [][2]int64) error {
+	if len(splits) == 0 {
+		return nil
+	}
+
+	segments := splitRollupSegments(splits, k.rollups.watermark.Load())
+	return k.scanRollups(rq, labelFilters, segments, func(_ string, ts int64, count, _ float64) {
+		if i := splitIndex(splits, ts); i >= 0 {
+			counts[i][1] += int64(count)
+		}
+	})
+}
+
+// splitRollupSegments returns segments of the time splits, as created by timeSplits. Rollups are used only
+// within the splits, so that each rolled-up period belongs to a single split.
+func splitRollupSegments(splits [][2]int64, watermark int64) []rollupSegment {
+	var segments []rollupSegment
+	for _, split := range splits {
+		segments = appendRollupSegments(segments, split[0]*1000, split[1]*1000, watermark)
+	}
+
+	return segments
+}
@@ -0,0 +1,136 @@
+package kero
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRollupSegments(t *testing.T) {
+	day := 20000 * dayMillis
+	start := day + 30*time.Minute.Milliseconds()
+	end := day + 2*dayMillis + 90*time.Minute.Milliseconds()
+	watermark := day + 2*dayMillis + hourMillis
+
+	want := []rollupSegment{
+		{start, day + hourMillis, rollupRaw},
+		{day + hourMillis, day + dayMillis, rollupHourly},
+		{day + dayMillis, day + 2*dayMillis, rollupDaily},
+		{day + 2*dayMillis, watermark, rollupHourly},
+		{watermark, end, rollupRaw},
+	}
+	segments := appendRollupSegments(nil, start, end, watermark)
+	if len(segments) != len(want) {
+		t.Fatal("expected", want, "got", segments)
+	}
+	for i := range want {
+		if segments[i] != want[i] {
+			t.Error("segment", i, "expected", want[i], "got", segments[i])
+		}
+	}
+
+	if segments := appendRollupSegments(nil, start, end, 0); len(segments) != 1 || segments[0].resolution != rollupRaw {
+		t.Error("expected only raw segment without rollups, got", segments)
+	}
+}
+
+func TestRollups(t *testing.T) {
+	dbPath := t.TempDir()
+	k, _ := New(WithDB(dbPath))
+
+	base := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -3)
+	events := []struct {
+		metric string
+		labels MetricLabels
+		value  float64
+		at     time.Time
+	}{
+		{HttpReqMetricName, MetricLabels{HttpPathLabel: "/", CountryLabel: "CH"}, 1, base.Add(70 * time.Minute)},
+		{HttpReqMetricName, MetricLabels{HttpPathLabel: "/"}, 1, base.Add(80 * time.Minute)},
+		{HttpReqDurationMetricName, MetricLabels{HttpPathLabel: "/"}, 100, base.Add(80 * time.Minute)},
+		{HttpReqMetricName, MetricLabels{HttpPathLabel: "/pricing"}, 1, base.Add(5 * time.Hour)},
+		{HttpReqDurationMetricName, MetricLabels{HttpPathLabel: "/"}, 300, base.Add(5 * time.Hour)},
+		{HttpReqMetricName, MetricLabels{HttpPathLabel: "/", BrowserFormFactorLabel: FormFactorBot, BrowserNameLabel: "Googlebot"}, 1, base.Add(26 * time.Hour)},
+		{HttpReqMetricName, MetricLabels{HttpPathLabel: "/pricing", HttpStatusClassLabel: "5xx"}, 1, base.Add(27 * time.Hour)},
+		{HttpReqMetricName, MetricLabels{HttpPathLabel: "/"}, 1, base.Add(49 * time.Hour)},
+		{HttpReqMetricName, MetricLabels{HttpPathLabel: "/"}, 1, time.Now().Add(-time.Minute)},
+	}
+	for _, e := range events {
+		k.trackAt(e.metric, e.labels, e.value, e.at)
+	}
+	k.Close()
+
+	// rollups are enabled for existing data
+	k, err := New(WithDB(dbPath), WithRollups(365*24*time.Hour))
+	if err != nil {
+		t.Fatal("failed to open kero with rollups", err)
+	}
+	defer k.Close()
+	if err := k.rollupPending(time.Now()); err != nil {
+		t.Fatal("failed to write rollups", err)
+	}
+	watermark := k.rollups.watermark.Load()
+	if watermark <= base.Add(49*time.Hour).UnixMilli() {
+		t.Fatal("expected rollups to cover past events, watermark is", time.UnixMilli(watermark))
+	}
+
+	start, end := base.Add(-time.Hour).Unix(), time.Now().Unix()
+	check := func(when string) {
+		if count := k.Count(HttpReqMetricName, start, end); count != 7 {
+			t.Error(when, "expected 7 requests, got", count)
+		}
+		if count := k.CountWithFilters(HttpReqMetricName, botFilter, start, end); count != 6 {
+			t.Error(when, "expected 6 requests by humans, got", count)
+		}
+		if count := k.CountWithFilters(HttpReqMetricName, serverErrorFilter, start, end); count != 1 {
+			t.Error(when, "expected 1 server error, got", count)
+		}
+
+		paths, err := k.AggregateDistinctByLabel(HttpReqMetricName, HttpPathLabel, botFilter, AggregateCount, start, end)
+		if err != nil || len(paths) != 2 || paths[0].Label != "/" || paths[0].Value != 4 || paths[1].Value != 2 {
+			t.Error(when, "unexpected requests by path", paths, err)
+		}
+		bots, err := k.AggregateDistinctByLabel(HttpReqMetricName, BrowserNameLabel, MetricLabels{BrowserFormFactorLabel: FormFactorBot}, AggregateCount, start, end)
+		if err != nil || len(bots) != 1 || bots[0].Label != "Googlebot" || bots[0].Value != 1 {
+			t.Error(when, "unexpected bots", bots, err)
+		}
+		durations, err := k.AggregateDistinctByLabel(HttpReqDurationMetricName, HttpPathLabel, nil, AggregateAvg, start, end)
+		if err != nil || len(durations) != 1 || durations[0].Value != 200 {
+			t.Error(when, "unexpected avg duration", durations, err)
+		}
+
+		histogram := k.CountHistogram(HttpReqMetricName, base.Unix(), base.AddDate(0, 0, 4).Unix())
+		want := []int64{3, 2, 1, 1}
+		for i, split := range histogram {
+			if split[1] != want[i] {
+				t.Error(when, "split", i, "expected", want[i], "got", split[1])
+			}
+		}
+	}
+
+	check("with raw data")
+
+	// rolled-up raw data is no longer needed
+	if err := k.db.Delete(context.Background(), math.MinInt64, watermark-1, queryMatchers("", nil)...); err != nil {
+		t.Fatal("failed to delete raw data", err)
+	}
+	if count, _ := k.AggregateDistinct(HttpReqMetricName, groupByLabel(HttpPathLabel), nil, AggregateCount, start, end); len(count) != 1 {
+		t.Fatal("expected only the latest event in raw data, got", count)
+	}
+	check("without raw data")
+
+	// filters not covered by rollups fall back to raw data
+	if count := k.CountWithFilters(HttpReqMetricName, MetricLabels{CountryLabel: "CH", HttpPathLabel: "/"}, start, end); count != 0 {
+		t.Error("expected raw data to be queried, got", count)
+	}
+}
+
+func TestInvalidRollupOptions(t *testing.T) {
+	if _, err := New(WithDB(t.TempDir()), WithRollups(0)); err == nil {
+		t.Error("should fail without retention")
+	}
+	if _, err := New(WithDB(t.TempDir()), WithRollups(time.Hour, "")); err == nil {
+		t.Error("should fail with empty dimension")
+	}
+}
@@ -0,0 +1,98 @@
+package kero
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// name of the file in the database folder storing the salt of the current day
+const visitorSaltFileName = "visitor_salt"
+const visitorSaltSize = 32
+
+// length of the visitor ID in hex characters
+const visitorIdLength = 32
+
+// visitorSalt is a random key used for hashing visitor IDs. It's replaced with a new one every day (in UTC)
+// and previous keys are discarded, so IDs of the same visitor can't be linked across days.
+type visitorSalt struct {
+	lock sync.Mutex
+	path string
+	day  string
+	key  []byte
+}
+
+// loadVisitorSalt reads the salt stored in the database folder, so restarts within a day keep the same visitor IDs.
+func loadVisitorSalt(dbPath string) (*visitorSalt, error) {
+	s := &visitorSalt{path: filepath.Join(dbPath, visitorSaltFileName)}
+
+	contents, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	day, encodedKey, _ := strings.Cut(strings.TrimSpace(string(contents)), " ")
+	key, err := hex.DecodeString(encodedKey)
+	if err != nil || len(key) != visitorSaltSize {
+		fmt.Println("[kero] Ignoring invalid visitor salt", s.path)
+		return s, nil
+	}
+
+	s.day = day
+	s.key = key
+	return s, nil
+}
+
+// current returns the salt for the day, creating a new one if the day has changed.
+func (s *visitorSalt) current(now time.Time) []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	day := now.UTC().Format(time.DateOnly)
+	if day == s.day {
+		return s.key
+	}
+
+	key := make([]byte, visitorSaltSize)
+	if _, err := rand.Read(key); err != nil {
+		fmt.Println("[kero] Failed to generate new visitor salt, reusing the previous one", err)
+		return s.key
+	}
+
+	s.day = day
+	s.key = key
+
+	if err := s.save(); err != nil {
+		fmt.Println("[kero] Failed to save visitor salt", err)
+	}
+
+	return s.key
+}
+
+func (s *visitorSalt) save() error {
+	tmpPath := s.path + ".tmp"
+	contents := s.day + " " + hex.EncodeToString(s.key) + "\n"
+	if err := os.WriteFile(tmpPath, []byte(contents), 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, s.path)
+}
+
+// hash returns a keyed hash of the value using the salt of the day.
+func (s *visitorSalt) hash(value string, now time.Time) string {
+	mac := hmac.New(sha256.New, s.current(now))
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))[:visitorIdLength]
+}
@@ -0,0 +1,77 @@
+package kero
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVisitorSaltRotation(t *testing.T) {
+	dbPath := t.TempDir()
+	salt, err := loadVisitorSalt(dbPath)
+	if err != nil {
+		t.Fatal("failed to load salt", err)
+	}
+
+	day := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	key := salt.current(day)
+	if len(key) != visitorSaltSize {
+		t.Fatal("expected salt of", visitorSaltSize, "bytes, got", len(key))
+	}
+	if !bytes.Equal(key, salt.current(day.Add(13*time.Hour+59*time.Minute))) {
+		t.Error("expected the same salt within a day")
+	}
+
+	reloaded, _ := loadVisitorSalt(dbPath)
+	if !bytes.Equal(key, reloaded.current(day)) {
+		t.Error("expected the salt to be persisted")
+	}
+
+	nextDay := day.Add(14 * time.Hour)
+	if bytes.Equal(key, salt.current(nextDay)) {
+		t.Error("expected a new salt on the next day")
+	}
+
+	contents, _ := os.ReadFile(filepath.Join(dbPath, visitorSaltFileName))
+	if !strings.HasPrefix(string(contents), "2024-03-02 ") || strings.Count(string(contents), "\n") != 1 {
+		t.Error("expected only the salt of the current day to be stored, got", string(contents))
+	}
+
+	if salt.hash("visitor", nextDay) == salt.hash("visitor", day) {
+		t.Error("expected visitor IDs to differ between days")
+	}
+}
+
+func TestVisitorIdIsSalted(t *testing.T) {
+	dbPath := t.TempDir()
+	k, _ := New(WithDB(dbPath))
+	headers := http.Header{"User-Agent": []string{"Mozilla/5.0"}}
+
+	id := k.visitorId("127.0.0.1", headers)[VisitorIdLabel]
+	if len(id) != visitorIdLength {
+		t.Error("expected visitor ID of", visitorIdLength, "characters, got", id)
+	}
+	if id != k.visitorId("127.0.0.1", headers)[VisitorIdLabel] {
+		t.Error("expected visitor ID to be stable")
+	}
+	if id == k.visitorId("127.0.0.2", headers)[VisitorIdLabel] {
+		t.Error("expected visitor IDs of different IPs to differ")
+	}
+	k.Close()
+
+	k, _ = New(WithDB(dbPath))
+	defer k.Close()
+	if id != k.visitorId("127.0.0.1", headers)[VisitorIdLabel] {
+		t.Error("expected visitor ID to be the same after restart")
+	}
+
+	other, _ := New(WithDB(t.TempDir()))
+	defer other.Close()
+	if id == other.visitorId("127.0.0.1", headers)[VisitorIdLabel] {
+		t.Error("expected visitor IDs of different databases to differ")
+	}
+}
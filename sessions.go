@@ -0,0 +1,194 @@
+package kero
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+const defaultSessionTimeout = 30 * time.Minute
+
+// ExitRateKey is the key in [AggregatedMetric.Extra] with the percentage of page views which were the last one in the session.
+const ExitRateKey = "exit_rate"
+
+// Session is a single visit, ie. page views of a visitor without a longer period of inactivity in between.
+type Session struct {
+	VisitorId string
+	Start     int64    // Unix time in seconds of the first page view
+	End       int64    // Unix time in seconds of the last page view
+	Paths     []string // Visited paths, in order of visit
+}
+
+// Duration returns the time between the first and the last page view of the session.
+func (s *Session) Duration() time.Duration {
+	return time.Duration(s.End-s.Start) * time.Second
+}
+
+// EntryPath returns the first visited path.
+func (s *Session) EntryPath() string {
+	return s.Paths[0]
+}
+
+// ExitPath returns the last visited path.
+func (s *Session) ExitPath() string {
+	return s.Paths[len(s.Paths)-1]
+}
+
+// IsBounce reports whether the visitor left after viewing a single page.
+func (s *Session) IsBounce() bool {
+	return len(s.Paths) == 1
+}
+
+// SessionStats summarizes sessions within a timeframe.
+type SessionStats struct {
+	Sessions        int
+	BounceRate      float64 // Percentage of sessions with only one page view
+	AvgDuration     time.Duration
+	PagesPerSession float64
+}
+
+// WithSessionTimeout sets the period of inactivity after which the next page view of a visitor starts a new session.
+// Defaults to 30 minutes.
+func WithSessionTimeout(timeout time.Duration) KeroOption {
+	return func(k *Kero) error {
+		if timeout <= 0 {
+			return errors.New("session timeout must be positive")
+		}
+		k.sessionTimeout = timeout
+		return nil
+	}
+}
+
+// Sessions groups page views (ie. `http_req` events) matching the filters by visitor
+// and splits them into sessions after the configured period of inactivity (see [WithSessionTimeout]).
+// Sessions are returned in order of their start.
+func (k *Kero) Sessions(labelFilters MetricLabels, start int64, end int64) ([]Session, error) {
+	metrics, err := k.Query(HttpReqMetricName, labelFilters, start, end)
+	if err != nil {
+		return []Session{}, err
+	}
+
+	timeoutMillis := k.sessionTimeout.Milliseconds()
+
+	sessions := []Session{}
+	// index of the last session of each visitor
+	lastSession := make(map[string]int)
+	lastSeen := make(map[string]int64)
+
+	// metrics are sorted by newest first
+	for i := len(metrics) - 1; i >= 0; i-- {
+		metric := metrics[i]
+		visitorId, ok := metric.Labels[VisitorIdLabel]
+		if !ok {
+			continue
+		}
+
+		idx, exists := lastSession[visitorId]
+		if !exists || metric.tsMillis-lastSeen[visitorId] > timeoutMillis {
+			sessions = append(sessions, Session{VisitorId: visitorId, Start: metric.Ts})
+			idx = len(sessions) - 1
+			lastSession[visitorId] = idx
+		}
+
+		lastSeen[visitorId] = metric.tsMillis
+		sessions[idx].End = metric.Ts
+		sessions[idx].Paths = append(sessions[idx].Paths, metric.Labels[HttpPathLabel])
+	}
+
+	return sessions, nil
+}
+
+// SessionStats calculates bounce rate, average visit duration and number of pages per session
+// for sessions within the timeframe. See [Kero.Sessions].
+func (k *Kero) SessionStats(labelFilters MetricLabels, start int64, end int64) (SessionStats, error) {
+	sessions, err := k.Sessions(labelFilters, start, end)
+	if err != nil {
+		return SessionStats{}, err
+	}
+
+	return summarizeSessions(sessions), nil
+}
+
+func summarizeSessions(sessions []Session) SessionStats {
+	stats := SessionStats{Sessions: len(sessions)}
+	if len(sessions) == 0 {
+		return stats
+	}
+
+	bounces, pages := 0, 0
+	var duration time.Duration
+	for i := range sessions {
+		if sessions[i].IsBounce() {
+			bounces += 1
+		}
+		pages += len(sessions[i].Paths)
+		duration += sessions[i].Duration()
+	}
+
+	count := float64(len(sessions))
+	stats.BounceRate = float64(bounces) / count * 100
+	stats.AvgDuration = time.Duration(float64(duration) / count)
+	stats.PagesPerSession = float64(pages) / count
+
+	return stats
+}
+
+// EntryPages returns the number of sessions which started on each of the paths within the timeframe.
+// Results are sorted by highest value first.
+func (k *Kero) EntryPages(labelFilters MetricLabels, start int64, end int64) ([]AggregatedMetric, error) {
+	sessions, err := k.Sessions(labelFilters, start, end)
+	if err != nil {
+		return []AggregatedMetric{}, err
+	}
+
+	counts := make(map[string]int)
+	for i := range sessions {
+		counts[sessions[i].EntryPath()] += 1
+	}
+
+	allMetrics := []AggregatedMetric{}
+	for path, count := range counts {
+		allMetrics = append(allMetrics, AggregatedMetric{
+			Label: path,
+			Value: float64(count),
+		})
+	}
+
+	sort.SliceStable(allMetrics, func(i, j int) bool { return allMetrics[i].Value > allMetrics[j].Value })
+
+	return allMetrics, nil
+}
+
+// ExitPages returns the number of sessions which ended on each of the paths within the timeframe.
+// Exit rate, the percentage of page views of the path which were the last in the session, is provided with ExitRateKey.
+// Results are sorted by highest value first.
+func (k *Kero) ExitPages(labelFilters MetricLabels, start int64, end int64) ([]AggregatedMetric, error) {
+	sessions, err := k.Sessions(labelFilters, start, end)
+	if err != nil {
+		return []AggregatedMetric{}, err
+	}
+
+	exits := make(map[string]int)
+	views := make(map[string]int)
+	for i := range sessions {
+		exits[sessions[i].ExitPath()] += 1
+		for _, path := range sessions[i].Paths {
+			views[path] += 1
+		}
+	}
+
+	allMetrics := []AggregatedMetric{}
+	for path, count := range exits {
+		allMetrics = append(allMetrics, AggregatedMetric{
+			Label: path,
+			Value: float64(count),
+			Extra: map[string]float64{
+				ExitRateKey: float64(count) / float64(views[path]) * 100,
+			},
+		})
+	}
+
+	sort.SliceStable(allMetrics, func(i, j int) bool { return allMetrics[i].Value > allMetrics[j].Value })
+
+	return allMetrics, nil
+}
@@ -0,0 +1,132 @@
+package kero
+
+import (
+	"testing"
+	"time"
+)
+
+type testPageView struct {
+	visitor string
+	path    string
+	at      time.Duration // since the start of the test timeframe
+}
+
+// trackPageViews writes page views at specific times, relative to start.
+func trackPageViews(t *testing.T, k *Kero, start time.Time, views []testPageView) {
+	for _, view := range views {
+		labels := MetricLabels{VisitorIdLabel: view.visitor, HttpPathLabel: view.path}
+		if err := k.trackAt(HttpReqMetricName, labels, 1, start.Add(view.at)); err != nil {
+			t.Fatal("failed to track page view", err)
+		}
+	}
+	k.Flush()
+}
+
+func TestSessions(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()), WithSessionTimeout(10*time.Minute))
+	defer k.Close()
+
+	start := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	trackPageViews(t, k, start, []testPageView{
+		{"a", "/", 0},
+		{"b", "/pricing", time.Minute},
+		{"a", "/pricing", 2 * time.Minute},
+		{"a", "/signup", 5 * time.Minute},
+		// new session for "a" after the timeout
+		{"a", "/blog", 30 * time.Minute},
+		{"c", "/blog", 31 * time.Minute},
+		{"c", "/", 33 * time.Minute},
+	})
+
+	sessions, err := k.Sessions(nil, start.Unix(), time.Now().Unix())
+	if err != nil {
+		t.Fatal("failed to load sessions", err)
+	}
+
+	wants := []Session{
+		{VisitorId: "a", Paths: []string{"/", "/pricing", "/signup"}},
+		{VisitorId: "b", Paths: []string{"/pricing"}},
+		{VisitorId: "a", Paths: []string{"/blog"}},
+		{VisitorId: "c", Paths: []string{"/blog", "/"}},
+	}
+	if len(sessions) != len(wants) {
+		t.Fatal("expected", len(wants), "sessions, got", len(sessions), sessions)
+	}
+	for i, want := range wants {
+		got := sessions[i]
+		if got.VisitorId != want.VisitorId || len(got.Paths) != len(want.Paths) {
+			t.Fatal("session", i, "expected", want, "got", got)
+		}
+		for j := range want.Paths {
+			if got.Paths[j] != want.Paths[j] {
+				t.Error("session", i, "expected path", want.Paths[j], "got", got.Paths[j])
+			}
+		}
+	}
+
+	if d := sessions[0].Duration(); d != 5*time.Minute {
+		t.Error("expected first session to last 5 minutes, got", d)
+	}
+
+	stats, err := k.SessionStats(nil, start.Unix(), time.Now().Unix())
+	if err != nil {
+		t.Fatal("failed to load session stats", err)
+	}
+	if stats.Sessions != 4 {
+		t.Error("expected 4 sessions, got", stats.Sessions)
+	}
+	if stats.BounceRate != 50 {
+		t.Error("expected bounce rate of 50%, got", stats.BounceRate)
+	}
+	if stats.PagesPerSession != 7.0/4 {
+		t.Error("expected 1.75 pages per session, got", stats.PagesPerSession)
+	}
+	if stats.AvgDuration != 7*time.Minute/4 {
+		t.Error("expected average duration of 1m45s, got", stats.AvgDuration)
+	}
+}
+
+func TestInvalidSessionTimeout(t *testing.T) {
+	if _, err := New(WithDB(t.TempDir()), WithSessionTimeout(0)); err == nil {
+		t.Error("should fail with empty session timeout")
+	}
+}
+
+func TestEntryAndExitPages(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()))
+	defer k.Close()
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	trackPageViews(t, k, start, []testPageView{
+		{"a", "/", 0},
+		{"a", "/pricing", time.Minute},
+		{"b", "/", 2 * time.Minute},
+		{"c", "/blog", 3 * time.Minute},
+		{"c", "/", 4 * time.Minute},
+		{"c", "/pricing", 5 * time.Minute},
+	})
+
+	entries, err := k.EntryPages(nil, start.Unix(), time.Now().Unix())
+	if err != nil {
+		t.Fatal("failed to load entry pages", err)
+	}
+	if len(entries) != 2 || entries[0].Label != "/" || entries[0].Value != 2 || entries[1].Label != "/blog" {
+		t.Error("unexpected entry pages", entries)
+	}
+
+	exits, err := k.ExitPages(nil, start.Unix(), time.Now().Unix())
+	if err != nil {
+		t.Fatal("failed to load exit pages", err)
+	}
+	if len(exits) != 2 || exits[0].Label != "/pricing" || exits[0].Value != 2 {
+		t.Fatal("unexpected exit pages", exits)
+	}
+	// every view of /pricing was the last one
+	if rate := exits[0].Extra[ExitRateKey]; rate != 100 {
+		t.Error("expected /pricing exit rate of 100%, got", rate)
+	}
+	// one of three views of / was the last one
+	if rate := exits[1].Extra[ExitRateKey]; rate < 33 || rate > 34 {
+		t.Error("expected / exit rate of 33%, got", rate)
+	}
+}
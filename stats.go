@@ -0,0 +1,199 @@
+package kero
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"time"
+)
+
+// valueStats accumulates values of a group for all aggregation methods in a single pass.
+type valueStats struct {
+	count float64
+	sum   float64
+	min   float64
+	max   float64
+	mean  float64 // running mean and sum of squared differences from it, as in Welford's algorithm
+	m2    float64
+
+	values []float64 // kept only when percentiles are needed
+	sorted bool
+}
+
+func (s *valueStats) add(value float64, keepValue bool) {
+	if s.count == 0 || value < s.min {
+		s.min = value
+	}
+	if s.count == 0 || value > s.max {
+		s.max = value
+	}
+
+	s.count += 1
+	s.sum += value
+	delta := value - s.mean
+	s.mean += delta / s.count
+	s.m2 += delta * (value - s.mean)
+
+	if keepValue {
+		s.values = append(s.values, value)
+		s.sorted = false
+	}
+}
+
+func (s *valueStats) aggregate(aggregateBy AggregationMethod) float64 {
+	if s.count == 0 {
+		return 0
+	}
+
+	switch aggregateBy {
+	case AggregateCount:
+		return s.count
+	case AggregateSum:
+		return s.sum
+	case AggregateAvg:
+		return s.sum / s.count
+	case AggregateMin:
+		return s.min
+	case AggregateMax:
+		return s.max
+	case AggregateStdDev:
+		return math.Sqrt(s.m2 / s.count)
+	case AggregateP50:
+		return s.percentile(0.5)
+	case AggregateP75:
+		return s.percentile(0.75)
+	case AggregateP90:
+		return s.percentile(0.9)
+	case AggregateP95:
+		return s.percentile(0.95)
+	case AggregateP99:
+		return s.percentile(0.99)
+	default:
+		return 0
+	}
+}
+
+// percentile interpolates between the two values closest to the rank of the percentile.
+func (s *valueStats) percentile(p float64) float64 {
+	if len(s.values) == 0 {
+		return 0
+	}
+	if !s.sorted {
+		sort.Float64s(s.values)
+		s.sorted = true
+	}
+
+	rank := p * float64(len(s.values)-1)
+	lower := int(rank)
+	if lower+1 >= len(s.values) {
+		return s.values[lower]
+	}
+
+	return s.values[lower] + (s.values[lower+1]-s.values[lower])*(rank-float64(lower))
+}
+
+func (m AggregationMethod) isPercentile() bool {
+	return m >= AggregateP50 && m <= AggregateP99
+}
+
+// AggregateDistinctWithExtra is the same as [Kero.AggregateDistinct] while also aggregating values of each group
+// by the extra methods, added to [AggregatedMetric.Extra] under the name of the method (ie. "p95").
+// All methods are calculated in a single pass through the matching events.
+func (k *Kero) AggregateDistinctWithExtra(
+	metricName string,
+	groupBy GroupMetricBy,
+	labelFilters MetricLabels,
+	aggregateBy AggregationMethod,
+	extra []AggregationMethod,
+	start int64,
+	end int64,
+) ([]AggregatedMetric, error) {
+	keepValues := aggregateBy.isPercentile() || slices.ContainsFunc(extra, AggregationMethod.isPercentile)
+
+	groups := make(map[string]*valueStats)
+	for metric, err := range k.QueryIter(metricName, labelFilters, start, end) {
+		if err != nil {
+			return []AggregatedMetric{}, err
+		}
+
+		id := groupBy(metric)
+		if len(id) == 0 {
+			continue
+		}
+		stats, exists := groups[id]
+		if !exists {
+			stats = &valueStats{}
+			groups[id] = stats
+		}
+		stats.add(metric.Value, keepValues)
+	}
+
+	allMetrics := make([]AggregatedMetric, 0, len(groups))
+	for id, stats := range groups {
+		row := AggregatedMetric{Label: id, Value: stats.aggregate(aggregateBy)}
+		if len(extra) > 0 {
+			row.Extra = make(map[string]float64, len(extra))
+			for _, method := range extra {
+				row.Extra[method.Name()] = stats.aggregate(method)
+			}
+		}
+		allMetrics = append(allMetrics, row)
+	}
+
+	sort.SliceStable(allMetrics, func(i, j int) bool {
+		return allMetrics[i].Value > allMetrics[j].Value
+	})
+
+	return allMetrics, nil
+}
+
+// AggregateHistogram aggregates values of matching events within each time subdivision of the timeframe,
+// ie. the 95th percentile of request durations per day. Values are rounded to the nearest integer
+// and are 0 in subdivisions without events. See [Kero.CountHistogramWithInterval] for reference on subdivisions.
+func (k *Kero) AggregateHistogram(
+	metric string,
+	labelFilters MetricLabels,
+	aggregateBy AggregationMethod,
+	interval time.Duration,
+	start int64,
+	end int64,
+) ([][2]int64, error) {
+	return k.aggregateHistogram(metric, labelFilters, aggregateBy, k.histogramSplits(interval, start, end, k.location))
+}
+
+func (k *Kero) aggregateHistogram(metric string, labelFilters MetricLabels, aggregateBy AggregationMethod, splits [][2]int64) ([][2]int64, error) {
+	stats, err := k.valueStatsInSplits(metric, labelFilters, splits, aggregateBy.isPercentile())
+	if err != nil {
+		return nil, err
+	}
+
+	histogram := make([][2]int64, len(splits))
+	for i, split := range splits {
+		histogram[i] = [2]int64{split[0], int64(math.Round(stats[i].aggregate(aggregateBy)))}
+	}
+
+	return histogram, nil
+}
+
+// valueStatsInSplits accumulates values of matching events within each of the time splits.
+func (k *Kero) valueStatsInSplits(metric string, labelFilters MetricLabels, splits [][2]int64, keepValues bool) ([]*valueStats, error) {
+	stats := make([]*valueStats, len(splits))
+	for i := range stats {
+		stats[i] = &valueStats{}
+	}
+	if len(splits) == 0 {
+		return stats, nil
+	}
+
+	for m, err := range k.QueryIter(metric, labelFilters, splits[0][0], splits[len(splits)-1][1]-1) {
+		if err != nil {
+			return nil, err
+		}
+
+		if split := splitIndex(splits, m.Ts*1000); split >= 0 {
+			stats[split].add(m.Value, keepValues)
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,102 @@
+package kero
+
+import (
+	"math"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestValueStats(t *testing.T) {
+	stats := &valueStats{}
+	for i := 10; i >= 1; i-- {
+		stats.add(float64(i), true)
+	}
+
+	wants := map[AggregationMethod]float64{
+		AggregateCount:  10,
+		AggregateSum:    55,
+		AggregateAvg:    5.5,
+		AggregateMin:    1,
+		AggregateMax:    10,
+		AggregateStdDev: math.Sqrt(8.25),
+		AggregateP50:    5.5,
+		AggregateP75:    7.75,
+		AggregateP90:    9.1,
+		AggregateP99:    9.91,
+	}
+	for method, want := range wants {
+		if got := stats.aggregate(method); math.Abs(got-want) > 1e-9 {
+			t.Error(method.Name(), "expected", want, "got", got)
+		}
+	}
+
+	if (&valueStats{}).aggregate(AggregateP95) != 0 {
+		t.Error("expected 0 without values")
+	}
+}
+
+func TestParseAggregationMethod(t *testing.T) {
+	for _, method := range []AggregationMethod{AggregateCount, AggregateAvg, AggregateStdDev, AggregateP99} {
+		if parsed, err := ParseAggregationMethod(method.Name()); err != nil || parsed != method {
+			t.Error("expected", method, "got", parsed, err)
+		}
+	}
+	if _, err := ParseAggregationMethod("median"); err == nil {
+		t.Error("should fail with unknown method")
+	}
+}
+
+// trackDurations writes durations of requests to the route, one second apart.
+func trackDurations(t *testing.T, k *Kero, start time.Time, route string, durations ...float64) {
+	for i, duration := range durations {
+		labels := MetricLabels{HttpMethodLabel: "GET", HttpRouteLabel: route}
+		if err := k.trackAt(HttpReqDurationMetricName, labels, duration, start.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatal("failed to track duration", err)
+		}
+	}
+	k.Flush()
+}
+
+func TestAggregatePercentiles(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()), WithTimezone(time.UTC))
+	defer k.Close()
+
+	start := time.Now().Add(-2 * time.Hour).Truncate(time.Hour)
+	durations := make([]float64, 100)
+	for i := range durations {
+		durations[i] = 10
+	}
+	// a single slow outlier
+	durations[99] = 5010
+	trackDurations(t, k, start, "/users/:id", durations...)
+	trackDurations(t, k, start.Add(time.Hour), "/", 100, 200)
+
+	data, err := k.AggregateDistinctWithExtra(
+		HttpReqDurationMetricName, groupByRoute, nil, AggregateAvg,
+		[]AggregationMethod{AggregateP50, AggregateMax}, start.Unix(), time.Now().Unix(),
+	)
+	if err != nil || len(data) != 2 {
+		t.Fatal("expected 2 routes, got", data, err)
+	}
+	if data[0].Label != "GET /" || data[0].Value != 150 || data[0].Extra["p50"] != 150 {
+		t.Error("unexpected stats of GET /", data[0])
+	}
+	if data[1].Value != 60 || data[1].Extra["p50"] != 10 || data[1].Extra["max"] != 5010 {
+		t.Error("unexpected stats of GET /users/:id", data[1])
+	}
+
+	histogram, err := k.AggregateHistogram(HttpReqDurationMetricName, nil, AggregateMax, AggregateByHour, start.Unix(), start.Add(2*time.Hour).Unix()-1)
+	if err != nil || len(histogram) != 2 || histogram[0][1] != 5010 || histogram[1][1] != 200 {
+		t.Error("unexpected hourly max durations", histogram, err)
+	}
+
+	dash := Dashboard{}
+	query := url.Values{"from": {start.Format(time.RFC3339)}, "to": {time.Now().Format(time.RFC3339)}, "route": {"GET /users/:id"}}
+	if err := dash.LoadDataFromQuery(k, query); err != nil {
+		t.Fatal("failed to load dashboard", err)
+	}
+	if dash.RouteLatency == nil || len(dash.RouteLatency.ChartData) == 0 || dash.RouteLatency.ChartData[0].Value != 10 {
+		t.Error("expected p95 latency of the route", dash.RouteLatency)
+	}
+}
@@ -0,0 +1,217 @@
+package kero
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+type CompareMode string
+
+const (
+	ComparePrevious CompareMode = "prev" // Period of the same length immediately before the timeframe
+	CompareYearAgo  CompareMode = "yoy"  // Same dates a year before
+	CompareNone     CompareMode = "none" // No comparison
+)
+
+// Description describes the compared period, ie. "previous period". Empty for [CompareNone].
+func (m CompareMode) Description() string {
+	switch m {
+	case ComparePrevious:
+		return "previous period"
+	case CompareYearAgo:
+		return "same period last year"
+	default:
+		return ""
+	}
+}
+
+// TimeframePresets are the values of the `t` param accepted by [ParseTimeframe], in order shown on the dashboard.
+var TimeframePresets = []struct{ Key, Label string }{
+	{"t", "Today"},
+	{"24h", "Past 24 hours"},
+	{"7d", "Past 7 days"},
+	{"30d", "Past 30 days"},
+	{"12m", "Past 12 months"},
+	{"mtd", "Month to date"},
+	{"ytd", "Year to date"},
+}
+
+// Timeframe is the period shown on the dashboard and the period it's compared to.
+// Times are in Unix seconds, with both start and end inclusive.
+type Timeframe struct {
+	Start        int64
+	End          int64
+	Preset       string // Key of one of [TimeframePresets], empty for custom ranges
+	Compare      CompareMode
+	CompareStart int64 // Zero with CompareNone
+	CompareEnd   int64
+	Interval     time.Duration  // Subdivision of charts, one of [HistogramIntervals], 0 if chosen automatically
+	Location     *time.Location // Timezone in which days start
+	Timezone     string         // Value of the `tz` param, empty when the default timezone is used
+}
+
+// ParseTimeframe reads the timeframe from the query params of a dashboard request:
+//
+//   - `t`: one of [TimeframePresets], defaulting to today
+//   - `from` and `to`: custom range used instead of `t`, each either a date (`2024-01-31`, with `to` including the whole day)
+//     or a time in RFC 3339 format
+//   - `compare`: `prev`, `yoy` or `none`, see [CompareMode]. Defaults to `prev`.
+//   - `interval`: subdivision of charts, one of [HistogramIntervals]. Chosen based on the timeframe's duration by default.
+//   - `tz`: name of the timezone from the IANA database, ie. `Europe/Zurich`. Defaults to loc, or the local timezone if it's nil.
+func ParseTimeframe(query url.Values, loc *time.Location) (Timeframe, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	tf := Timeframe{Location: loc}
+
+	if tz := query.Get("tz"); len(tz) > 0 {
+		var err error
+		if tf.Location, err = time.LoadLocation(tz); err != nil {
+			return tf, fmt.Errorf("invalid tz: %w", err)
+		}
+		tf.Timezone = tz
+	}
+
+	if query.Has("from") || query.Has("to") {
+		from, err := parseTimeframeDate(query.Get("from"), false, tf.Location)
+		if err != nil {
+			return tf, fmt.Errorf("invalid from: %w", err)
+		}
+		to, err := parseTimeframeDate(query.Get("to"), true, tf.Location)
+		if err != nil {
+			return tf, fmt.Errorf("invalid to: %w", err)
+		}
+		if from.After(to) {
+			return tf, fmt.Errorf("from is after to")
+		}
+		tf.Start, tf.End = from.Unix(), to.Unix()
+	} else {
+		tf.Preset = query.Get("t")
+		if len(tf.Preset) == 0 {
+			tf.Preset = "t"
+		}
+		tf.Start, tf.End = parseTimeframeString(tf.Preset, tf.Location)
+	}
+
+	interval, err := parseHistogramInterval(query.Get("interval"))
+	if err != nil {
+		return tf, err
+	}
+	if err := validateHistogramInterval(interval, tf.Start, tf.End); err != nil {
+		return tf, err
+	}
+	tf.Interval = interval
+
+	tf.Compare = CompareMode(query.Get("compare"))
+	switch tf.Compare {
+	case "", ComparePrevious:
+		tf.Compare = ComparePrevious
+		length := tf.End - tf.Start + 1
+		tf.CompareStart, tf.CompareEnd = tf.Start-length, tf.Start-1
+	case CompareYearAgo:
+		tf.CompareStart = tf.time(tf.Start).AddDate(-1, 0, 0).Unix()
+		tf.CompareEnd = tf.time(tf.End).AddDate(-1, 0, 0).Unix()
+	case CompareNone:
+	default:
+		return tf, fmt.Errorf("unknown compare mode %q", tf.Compare)
+	}
+
+	return tf, nil
+}
+
+func parseTimeframeDate(value string, endOfDay bool, loc *time.Location) (time.Time, error) {
+	if date, err := time.ParseInLocation(time.DateOnly, value, loc); err == nil {
+		if endOfDay {
+			return date.AddDate(0, 0, 1).Add(-time.Second), nil
+		}
+		return date, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// time returns the time of the timestamp in the timeframe's timezone.
+func (tf Timeframe) time(ts int64) time.Time {
+	if tf.Location == nil {
+		return time.Unix(ts, 0)
+	}
+
+	return time.Unix(ts, 0).In(tf.Location)
+}
+
+// Compared reports whether the timeframe is compared to another period.
+func (tf Timeframe) Compared() bool {
+	return tf.Compare != CompareNone
+}
+
+// Label describes the timeframe, ie. "Past 7 days" or "Jan 02, 2024 – Jan 31, 2024".
+func (tf Timeframe) Label() string {
+	for _, preset := range TimeframePresets {
+		if preset.Key == tf.Preset {
+			return preset.Label
+		}
+	}
+
+	return tf.time(tf.Start).Format("Jan 02, 2006") + " – " + tf.time(tf.End).Format("Jan 02, 2006")
+}
+
+// FromDate and ToDate return the first and the last day of the timeframe, as used by date inputs.
+func (tf Timeframe) FromDate() string {
+	return tf.time(tf.Start).Format(time.DateOnly)
+}
+
+func (tf Timeframe) ToDate() string {
+	return tf.time(tf.End).Format(time.DateOnly)
+}
+
+// Query returns params which [ParseTimeframe] parses into the same timeframe.
+func (tf Timeframe) Query() url.Values {
+	query := url.Values{}
+	if len(tf.Preset) > 0 {
+		query.Set("t", tf.Preset)
+	} else {
+		query.Set("from", tf.time(tf.Start).Format(time.RFC3339))
+		query.Set("to", tf.time(tf.End).Format(time.RFC3339))
+	}
+	if tf.Compare != ComparePrevious {
+		query.Set("compare", string(tf.Compare))
+	}
+	for _, interval := range HistogramIntervals {
+		if interval.Interval == tf.Interval {
+			query.Set("interval", interval.Name)
+		}
+	}
+	if len(tf.Timezone) > 0 {
+		query.Set("tz", tf.Timezone)
+	}
+
+	return query
+}
+
+// Change is the change of a value from its value in the compared period.
+type Change struct {
+	Current  float64
+	Previous float64
+}
+
+// Label formats the change as a percentage, or "new" if the value was 0 in the compared period.
+func (c Change) Label() string {
+	if c.Previous == 0 {
+		return "new"
+	}
+
+	return fmt.Sprintf("%+.0f%%", (c.Current-c.Previous)/c.Previous*100)
+}
+
+// Direction returns "up", "down" or "same", used as the CSS class of the change.
+func (c Change) Direction() string {
+	switch {
+	case c.Current > c.Previous:
+		return "up"
+	case c.Current < c.Previous:
+		return "down"
+	default:
+		return "same"
+	}
+}
@@ -0,0 +1,173 @@
+package kero
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseTimeframe(t *testing.T) {
+	tf, err := ParseTimeframe(url.Values{}, time.Local)
+	if err != nil || tf.Preset != "t" || tf.Compare != ComparePrevious {
+		t.Fatal("expected today compared to previous period, got", tf, err)
+	}
+	if tf.CompareEnd != tf.Start-1 || tf.End-tf.Start != tf.CompareEnd-tf.CompareStart {
+		t.Error("expected previous period of the same length right before the timeframe, got", tf)
+	}
+
+	tf, err = ParseTimeframe(url.Values{"from": {"2024-03-01"}, "to": {"2024-03-31"}, "compare": {"yoy"}}, time.Local)
+	if err != nil {
+		t.Fatal("failed to parse custom range", err)
+	}
+	wantStart := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	wantEnd := time.Date(2024, 3, 31, 23, 59, 59, 0, time.Local)
+	if tf.Start != wantStart.Unix() || tf.End != wantEnd.Unix() || len(tf.Preset) > 0 {
+		t.Error("expected March 2024, got", time.Unix(tf.Start, 0), time.Unix(tf.End, 0))
+	}
+	if tf.CompareStart != wantStart.AddDate(-1, 0, 0).Unix() || tf.CompareEnd != wantEnd.AddDate(-1, 0, 0).Unix() {
+		t.Error("expected March 2023, got", time.Unix(tf.CompareStart, 0), time.Unix(tf.CompareEnd, 0))
+	}
+	if tf.Label() != "Mar 01, 2024 – Mar 31, 2024" {
+		t.Error("unexpected label", tf.Label())
+	}
+
+	// Query round trips
+	parsed, err := ParseTimeframe(tf.Query(), time.Local)
+	if err != nil || parsed != tf {
+		t.Error("expected", tf, "got", parsed, err)
+	}
+
+	tf, err = ParseTimeframe(url.Values{"from": {"2024-03-01T10:00:00Z"}, "to": {"2024-03-01T12:00:00Z"}, "compare": {"none"}}, time.Local)
+	if err != nil || tf.End-tf.Start != 2*60*60 || tf.Compared() {
+		t.Error("expected 2 hours without comparison, got", tf, err)
+	}
+
+	// dates are parsed in the tz param's timezone, which is kept in the query
+	tf, err = ParseTimeframe(url.Values{"from": {"2024-03-01"}, "to": {"2024-03-01"}, "tz": {"America/New_York"}}, time.UTC)
+	if err != nil {
+		t.Fatal("failed to parse timeframe with tz", err)
+	}
+	newYork, _ := time.LoadLocation("America/New_York")
+	if tf.Start != time.Date(2024, 3, 1, 0, 0, 0, 0, newYork).Unix() || tf.FromDate() != "2024-03-01" || tf.ToDate() != "2024-03-01" {
+		t.Error("expected March 1st in New York, got", time.Unix(tf.Start, 0).In(newYork))
+	}
+	if parsed, err := ParseTimeframe(tf.Query(), time.UTC); err != nil || parsed.Start != tf.Start || parsed.Timezone != tf.Timezone {
+		t.Error("expected", tf, "got", parsed, err)
+	}
+
+	// presets start at midnight in the timezone
+	tf, err = ParseTimeframe(url.Values{"t": {"7d"}}, newYork)
+	if start := time.Unix(tf.Start, 0).In(newYork); err != nil || start.Hour() != 0 || start.Minute() != 0 {
+		t.Error("expected 7 days starting at midnight in New York, got", start, err)
+	}
+	if end := time.Unix(tf.End, 0).In(newYork); end.Hour() != 23 || end.Minute() != 59 {
+		t.Error("expected 7 days ending at the end of the day in New York, got", end)
+	}
+
+	tf, err = ParseTimeframe(url.Values{"t": {"12m"}, "interval": {"quarter"}}, time.UTC)
+	if err != nil || tf.Interval != AggregateByQuarter || tf.Query().Get("interval") != "quarter" {
+		t.Error("expected quarterly interval, got", tf, err)
+	}
+
+	tf, err = ParseTimeframe(url.Values{"from": {"2024-03-01"}, "to": {"2024-03-01"}}, nil)
+	if err != nil || tf.Location != time.Local || tf.Start != time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local).Unix() {
+		t.Error("expected local timezone without a location, got", tf, err)
+	}
+
+	invalid := []url.Values{
+		{"interval": {"fortnight"}},
+		{"t": {"12m"}, "interval": {"hour"}},
+		{"tz": {"Mars/Olympus_Mons"}},
+		{"from": {"2024-03-01"}},
+		{"from": {"yesterday"}, "to": {"2024-03-01"}},
+		{"from": {"2024-03-02"}, "to": {"2024-03-01"}},
+		{"compare": {"week"}},
+	}
+	for _, query := range invalid {
+		if _, err := ParseTimeframe(query, time.Local); err == nil {
+			t.Error("should fail with", query)
+		}
+	}
+}
+
+func TestFormattedTimestamp(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	midnight := time.Date(2024, 3, 1, 0, 0, 0, 0, tokyo)
+
+	bar := BarChartData{Timestamp: midnight.Unix(), location: tokyo}
+	if bar.FormattedTimestamp() != "Mar 01, 2024" {
+		t.Error("expected a day in Tokyo, got", bar.FormattedTimestamp())
+	}
+	bar.location = time.UTC
+	if bar.FormattedTimestamp() != "Feb 29, 2024 15:00" {
+		t.Error("expected an hour in UTC, got", bar.FormattedTimestamp())
+	}
+}
+
+func TestChange(t *testing.T) {
+	tests := []struct {
+		change           Change
+		label, direction string
+	}{
+		{Change{15, 10}, "+50%", "up"},
+		{Change{5, 10}, "-50%", "down"},
+		{Change{10, 10}, "+0%", "same"},
+		{Change{3, 0}, "new", "up"},
+	}
+	for _, test := range tests {
+		if test.change.Label() != test.label || test.change.Direction() != test.direction {
+			t.Error(test.change, "expected", test.label, test.direction, "got", test.change.Label(), test.change.Direction())
+		}
+	}
+}
+
+func TestDashboardComparison(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()))
+	defer k.Close()
+
+	now := time.Now().Truncate(time.Second)
+	trackPageViews(t, k, now, []testPageView{
+		{"a", "/", -time.Hour},
+		{"b", "/", -2 * time.Hour},
+		{"c", "/pricing", -3 * time.Hour},
+		// previous period
+		{"d", "/", -30 * time.Hour},
+	})
+
+	tf := Timeframe{Start: now.Add(-24 * time.Hour).Unix(), End: now.Unix(), Compare: ComparePrevious}
+	tf.CompareStart, tf.CompareEnd = tf.Start-24*60*60, tf.Start-1
+
+	dash := Dashboard{
+		Rows: [][]DashboardStat{{{
+			Title:       "Pages",
+			QueryMetric: HttpReqMetricName,
+			QueryLabel:  HttpPathLabel,
+		}}},
+	}
+	dash.LoadDataForTimeframe(k, tf)
+
+	if dash.ViewsTrend.CurrentValue != 3 || dash.ViewsTrend.PreviousValue != 1 || dash.ViewsTrend.ComparedTo == "" {
+		t.Error("unexpected views trend", dash.ViewsTrend)
+	}
+	if len(dash.ViewsChartData) == 0 || dash.ViewsChartData[0].CompareLabel == "" {
+		t.Error("expected chart to include compared period")
+	}
+
+	stat := dash.Rows[len(dash.Rows)-1][0]
+	if len(stat.Data) != 2 {
+		t.Fatal("expected 2 pages, got", stat.Data)
+	}
+	if change := stat.Change(stat.Data[0]); change == nil || change.Current != 2 || change.Previous != 1 {
+		t.Error("expected / to change from 1 to 2, got", change)
+	}
+	if change := stat.Change(stat.Data[1]); change == nil || change.Label() != "new" {
+		t.Error("expected /pricing to be new, got", change)
+	}
+
+	tf.Compare = CompareNone
+	dash.LoadDataForTimeframe(k, tf)
+	stat = dash.Rows[len(dash.Rows)-1][0]
+	if stat.Change(stat.Data[0]) != nil || dash.ViewsTrend.ComparedTo != "" {
+		t.Error("expected no comparison")
+	}
+}
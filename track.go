@@ -1,17 +1,29 @@
 package kero
 
 import (
-	"context"
-	plabels "github.com/prometheus/prometheus/model/labels"
+	"strings"
 	"time"
+
+	plabels "github.com/prometheus/prometheus/model/labels"
 )
 
+// Track queues the event to be written to the database by the ingestion worker.
+// Depending on the configured [IngestFullPolicy] it either blocks or returns ErrIngestQueueFull when the queue is full.
+// See [Kero.Flush] for making sure that the event has been written.
 func (k *Kero) Track(metric string, labels MetricLabels, value float64) error {
-	app := k.db.Appender(context.Background())
-	dbLabels := plabels.FromMap(labels)
-	dbLabels = append(dbLabels, plabels.FromStrings(plabels.MetricName, metric)...)
-	app.Append(0, dbLabels, time.Now().Unix(), value)
-	return app.Commit()
+	return k.trackAt(metric, labels, value, time.Now())
+}
+
+func (k *Kero) trackAt(metric string, labels MetricLabels, value float64, ts time.Time) error {
+	dbLabels := make([]plabels.Label, 0, len(labels)+1)
+	for name, val := range labels {
+		// values can be backed by buffers reused by the web framework (ie. Fiber)
+		// so they have to be copied before being queued
+		dbLabels = append(dbLabels, plabels.Label{Name: strings.Clone(name), Value: strings.Clone(val)})
+	}
+	dbLabels = append(dbLabels, plabels.Label{Name: plabels.MetricName, Value: strings.Clone(metric)})
+
+	return k.enqueue(trackedEvent{plabels.New(dbLabels...), ts.UnixMilli(), value})
 }
 
 func (k *Kero) TrackOne(metric string, labels MetricLabels) error {
@@ -1,12 +1,11 @@
 package kero
 
 import (
-	"crypto/md5"
 	"encoding/base64"
-	"encoding/hex"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,8 +22,10 @@ type TrackedHttpReq struct {
 	Headers    http.Header
 	Query      url.Values
 	Route      string
-	ClientIp   string
+	ClientIp   string // Optional, used instead of resolving the client IP from RemoteAddr and forwarding headers
 	RemoteAddr string
+	// StatusCode of the response, known only after the handler has finished. Not tracked if 0.
+	StatusCode int
 }
 
 func TrackedRequestFromHttp(httpReq *http.Request) TrackedHttpReq {
@@ -46,6 +47,10 @@ func (k *Kero) ShouldTrackHttpRequest(path string) bool {
 		return false
 	}
 
+	if len(k.BeaconPath) > 1 && (k.BeaconPath == path || strings.HasPrefix(path, k.BeaconPath+"/")) {
+		return false
+	}
+
 	if k.IgnoreCommonPaths {
 		if path == "/favicon.ico" {
 			return false
@@ -74,7 +79,7 @@ func (k *Kero) TrackWithRequest(metric string, labels MetricLabels, value float6
 
 	clientIp := req.ClientIp
 	if len(clientIp) == 0 {
-		clientIp = getClientIp(req.Headers, req.RemoteAddr)
+		clientIp = k.clientIp(req.Headers, req.RemoteAddr)
 	}
 
 	allLabels := mergeMaps(
@@ -84,6 +89,7 @@ func (k *Kero) TrackWithRequest(metric string, labels MetricLabels, value float6
 			HttpPathLabel:   req.Path,
 			HttpRouteLabel:  req.Route,
 		},
+		statusLabels(req.StatusCode),
 		k.visitorId(clientIp, req.Headers),
 		k.locationLabels(clientIp),
 		k.userAgentLabels(req.Headers),
@@ -109,22 +115,46 @@ func (k *Kero) MeasureHttpRequest(req TrackedHttpReq, handler func()) {
 	start := time.Now()
 
 	defer func() {
-		duration := time.Since(start)
-		// duration.Milliseconds() performs integer rounding
-		ds := float64(duration.Nanoseconds()) / float64(1e6)
+		k.TrackHttpRequestDuration(req, time.Since(start))
+	}()
 
-		labels := MetricLabels{
+	handler()
+}
+
+// TrackHttpRequestDuration records how long it took to handle the request.
+// Useful when request details (ie. the route) are known only after the handler has finished,
+// otherwise see [Kero.MeasureHttpRequest].
+func (k *Kero) TrackHttpRequestDuration(req TrackedHttpReq, duration time.Duration) error {
+	// duration.Milliseconds() performs integer rounding
+	ds := float64(duration.Nanoseconds()) / float64(1e6)
+
+	labels := mergeMaps(
+		MetricLabels{
 			HttpMethodLabel: req.Method,
 			HttpPathLabel:   req.Path,
 			HttpRouteLabel:  req.Route,
-			// "$status_code":  strconv.Itoa(req.HttpRequest.Response.StatusCode),
-		}
-		// fmt.Println("tracked", labels[HttpRouteLabel], labels["$status_code"], )
+		},
+		statusLabels(req.StatusCode),
+	)
 
-		k.Track(HttpReqDurationMetricName, labels, ds)
-	}()
+	return k.Track(HttpReqDurationMetricName, labels, ds)
+}
 
-	handler()
+// statusLabels returns the status code and its class (ie. "404" and "4xx").
+func statusLabels(statusCode int) MetricLabels {
+	if statusCode < 100 || statusCode > 999 {
+		return MetricLabels{}
+	}
+
+	return MetricLabels{
+		HttpStatusCodeLabel:  strconv.Itoa(statusCode),
+		HttpStatusClassLabel: StatusClass(statusCode),
+	}
+}
+
+// StatusClass returns the class of the HTTP status code, ie. "2xx" for 200 or "5xx" for 503.
+func StatusClass(statusCode int) string {
+	return strconv.Itoa(statusCode/100) + "xx"
 }
 
 func (k *Kero) visitorId(ip string, headers http.Header) MetricLabels {
@@ -134,11 +164,9 @@ func (k *Kero) visitorId(ip string, headers http.Header) MetricLabels {
 		headers.Get("accept-encoding"),
 		headers.Get("accept-language"),
 	}, "|")
-	hash := md5.Sum([]byte(id))
-	hashString := hex.EncodeToString(hash[:])
 
 	return MetricLabels{
-		VisitorIdLabel: hashString,
+		VisitorIdLabel: k.visitorSalt.hash(id, time.Now()),
 	}
 }
 
@@ -240,25 +268,3 @@ func (k *Kero) isHttpClientLibrary(ua string) bool {
 
 	return false
 }
-
-func getClientIp(headers http.Header, remoteAddr string) string {
-	if ip := headers.Get("CF-Connecting-IP"); len(ip) > 1 {
-		return ip
-	}
-
-	if ff := headers.Get("X-Forwarded-For"); len(ff) > 1 {
-		if ips := strings.Split(ff, ", "); len(ips) > 0 {
-			return ips[0]
-		}
-	}
-
-	if ip := headers.Get("X-Real-IP"); len(ip) > 1 {
-		return ip
-	}
-
-	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
-		return host
-	}
-
-	return ""
-}
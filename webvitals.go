@@ -0,0 +1,151 @@
+package kero
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// WebVitalMetricPrefix is the prefix of metrics storing web vitals, see [WebVitals].
+const WebVitalMetricPrefix = "web_vital_"
+
+// ErrInvalidWebVital is returned by [Kero.TrackWebVital] for unknown vitals and invalid values.
+var ErrInvalidWebVital = errors.New("invalid web vital")
+
+// Ratings of web vitals, see [WebVital.Rate].
+const (
+	WebVitalGood             = "good"
+	WebVitalNeedsImprovement = "needs-improvement"
+	WebVitalPoor             = "poor"
+)
+
+// WebVital is one of the metrics of user experience measured in the browser by the beacon script.
+type WebVital struct {
+	Name   string  // Abbreviation, ie. "LCP"
+	Title  string  // Full name, ie. "Largest Contentful Paint"
+	Metric string  // Name of the metric storing measured values
+	Unit   string  // Unit of values, empty for unitless vitals (CLS)
+	Good   float64 // Highest value rated as good
+	Poor   float64 // Values above are rated as poor, and the ones between Good and Poor as needing improvement
+}
+
+// WebVitals are the vitals collected by the beacon script, with thresholds recommended by web.dev.
+var WebVitals = []WebVital{
+	{Name: "LCP", Title: "Largest Contentful Paint", Metric: WebVitalMetricPrefix + "lcp", Unit: "ms", Good: 2500, Poor: 4000},
+	{Name: "INP", Title: "Interaction to Next Paint", Metric: WebVitalMetricPrefix + "inp", Unit: "ms", Good: 200, Poor: 500},
+	{Name: "CLS", Title: "Cumulative Layout Shift", Metric: WebVitalMetricPrefix + "cls", Good: 0.1, Poor: 0.25},
+	{Name: "FCP", Title: "First Contentful Paint", Metric: WebVitalMetricPrefix + "fcp", Unit: "ms", Good: 1800, Poor: 3000},
+	{Name: "TTFB", Title: "Time to First Byte", Metric: WebVitalMetricPrefix + "ttfb", Unit: "ms", Good: 800, Poor: 1800},
+}
+
+// Rate returns [WebVitalGood], [WebVitalNeedsImprovement] or [WebVitalPoor] depending on the vital's thresholds.
+func (v WebVital) Rate(value float64) string {
+	switch {
+	case value <= v.Good:
+		return WebVitalGood
+	case value <= v.Poor:
+		return WebVitalNeedsImprovement
+	default:
+		return WebVitalPoor
+	}
+}
+
+// Format formats the value with the vital's unit, ie. "1250 ms" or "0.08".
+func (v WebVital) Format(value float64) string {
+	if len(v.Unit) == 0 {
+		return fmt.Sprintf("%.2f", value)
+	}
+
+	return fmt.Sprintf("%.0f %s", value, v.Unit)
+}
+
+func webVitalByMetric(metric string) (WebVital, bool) {
+	for _, vital := range WebVitals {
+		if vital.Metric == metric {
+			return vital, true
+		}
+	}
+
+	return WebVital{}, false
+}
+
+// TrackWebVital stores the value of the vital measured on the request's page, ie. `web_vital_lcp`.
+// Only the path, form factor and country are stored along with the value, as vitals are reported for most page views
+// and are aggregated by those labels on the dashboard. DNT and bot filtering apply as with other requests.
+func (k *Kero) TrackWebVital(metric string, value float64, req TrackedHttpReq) error {
+	vital, ok := webVitalByMetric(metric)
+	if !ok {
+		return fmt.Errorf("%w: unknown metric %q", ErrInvalidWebVital, metric)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) || value < 0 {
+		return fmt.Errorf("%w: invalid value %v of %s", ErrInvalidWebVital, value, vital.Name)
+	}
+	if !k.IgnoreDNT && req.Headers.Get("DNT") == "1" {
+		return nil
+	}
+
+	clientIp := req.ClientIp
+	if len(clientIp) == 0 {
+		clientIp = k.clientIp(req.Headers, req.RemoteAddr)
+	}
+	formFactor := k.userAgentLabels(req.Headers)[BrowserFormFactorLabel]
+	if k.IgnoreBots && formFactor == FormFactorBot {
+		return nil
+	}
+
+	labels := MetricLabels{
+		HttpPathLabel:          req.Path,
+		BrowserFormFactorLabel: formFactor,
+		CountryLabel:           k.locationLabels(clientIp)[CountryLabel],
+	}
+
+	return k.Track(vital.Metric, labels, value)
+}
+
+// WebVitalsByLabel returns the 75th percentile of each of the [WebVitals] grouped by the label, ie. by page with [HttpPathLabel].
+// Percentiles are added to [AggregatedMetric.Extra] under names of the vitals, while the value is the one of the first vital (LCP),
+// by which rows are sorted.
+func (k *Kero) WebVitalsByLabel(label string, labelFilters MetricLabels, start int64, end int64) ([]AggregatedMetric, error) {
+	rows := map[string]*AggregatedMetric{}
+	for _, vital := range WebVitals {
+		data, err := k.AggregateDistinct(vital.Metric, groupByLabel(label), labelFilters, AggregateP75, start, end)
+		if err != nil {
+			return []AggregatedMetric{}, err
+		}
+
+		for _, am := range data {
+			row, exists := rows[am.Label]
+			if !exists {
+				row = &AggregatedMetric{Label: am.Label, Extra: make(map[string]float64, len(WebVitals))}
+				rows[am.Label] = row
+			}
+			row.Extra[vital.Name] = am.Value
+		}
+	}
+
+	allRows := make([]AggregatedMetric, 0, len(rows))
+	for _, row := range rows {
+		row.Value = row.Extra[WebVitals[0].Name]
+		allRows = append(allRows, *row)
+	}
+	sortByValue(allRows)
+
+	return allRows, nil
+}
+
+// webVitalsByPageStat shows the 75th percentile of each vital by page, with the slowest pages first.
+var webVitalsByPageStat = DashboardStat{
+	Title:            "Web vitals by page",
+	UnitDisplayLabel: "Page",
+	CountLabel:       "LCP",
+	ExtraColumns: []StatColumn{
+		{Title: "INP", Key: "INP"},
+		{Title: "CLS", Key: "CLS", Format: "%.2f"},
+		{Title: "FCP", Key: "FCP"},
+		{Title: "TTFB", Key: "TTFB"},
+	},
+
+	QueryFunc: func(k *Kero, start, end int64) ([]AggregatedMetric, error) {
+		return k.WebVitalsByLabel(HttpPathLabel, botFilter, start, end)
+	},
+}
@@ -0,0 +1,139 @@
+package kero
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWebVitalRate(t *testing.T) {
+	lcp := WebVitals[0]
+	tests := map[float64]string{
+		0:    WebVitalGood,
+		2500: WebVitalGood,
+		2501: WebVitalNeedsImprovement,
+		4000: WebVitalNeedsImprovement,
+		9000: WebVitalPoor,
+	}
+	for value, want := range tests {
+		if got := lcp.Rate(value); got != want {
+			t.Error("expected", value, "to be rated", want, "got", got)
+		}
+	}
+
+	if cls, _ := webVitalByMetric("web_vital_cls"); cls.Format(0.0812) != "0.08" || lcp.Format(1250.4) != "1250 ms" {
+		t.Error("unexpected formatting of values", cls.Format(0.0812), lcp.Format(1250.4))
+	}
+}
+
+func TestTrackWebVital(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()), WithBotsIgnored(true))
+	defer k.Close()
+
+	req := TrackedHttpReq{
+		Method: http.MethodPost,
+		Path:   "/pricing",
+		Headers: http.Header{
+			"User-Agent": {"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"},
+			"Referer":    {"https://example.com/"},
+		},
+		RemoteAddr: "127.0.0.1:1234",
+	}
+	if err := k.TrackWebVital("web_vital_lcp", 1800, req); err != nil {
+		t.Fatal("failed to track web vital", err)
+	}
+	if err := k.TrackBeacon(BeaconEvent{Name: "web_vital_cls", URL: "https://example.com/pricing", Value: 0.05}, req); err != nil {
+		t.Fatal("failed to track web vital from beacon", err)
+	}
+
+	for _, test := range []struct {
+		metric string
+		value  float64
+	}{
+		{"web_vital_fid", 100},
+		{"web_vital_lcp", -1},
+	} {
+		if err := k.TrackWebVital(test.metric, test.value, req); !errors.Is(err, ErrInvalidWebVital) {
+			t.Error("expected", test, "to be invalid, got", err)
+		}
+	}
+	if err := k.TrackBeacon(BeaconEvent{Name: "web_vital_fid", URL: "https://example.com/"}, req); !errors.Is(err, ErrInvalidBeacon) {
+		t.Error("expected unknown vital to be an invalid beacon, got", err)
+	}
+	k.Flush()
+
+	now := time.Now().Unix()
+	lcp, _ := k.Query("web_vital_lcp", nil, 0, now)
+	if len(lcp) != 1 || lcp[0].Value != 1800 {
+		t.Fatal("expected LCP to be tracked, got", lcp)
+	}
+	want := MetricLabels{MetricName: "web_vital_lcp", HttpPathLabel: "/pricing", BrowserFormFactorLabel: FormFactorMobile}
+	if len(lcp[0].Labels) != len(want) {
+		t.Error("expected only path, form factor and country labels, got", lcp[0].Labels)
+	}
+	for label, value := range want {
+		if lcp[0].Labels[label] != value {
+			t.Error("expected label", label, "to be", value, "got", lcp[0].Labels[label])
+		}
+	}
+	if cls, _ := k.Query("web_vital_cls", nil, 0, now); len(cls) != 1 || cls[0].Value != 0.05 {
+		t.Error("expected CLS to be tracked, got", cls)
+	}
+}
+
+func TestWebVitalsDashboard(t *testing.T) {
+	k, _ := New(WithDB(t.TempDir()), WithTimezone(time.UTC))
+	defer k.Close()
+
+	start := time.Now().Add(-2 * time.Hour).Truncate(time.Hour)
+	samples := []struct {
+		metric string
+		path   string
+		value  float64
+	}{
+		{"web_vital_lcp", "/", 1000},
+		{"web_vital_lcp", "/", 2000},
+		{"web_vital_lcp", "/", 3000},
+		{"web_vital_lcp", "/", 5000},
+		{"web_vital_lcp", "/docs", 1200},
+		{"web_vital_cls", "/docs", 0.3},
+	}
+	for i, sample := range samples {
+		labels := MetricLabels{HttpPathLabel: sample.path, BrowserFormFactorLabel: FormFactorDesktop}
+		if err := k.trackAt(sample.metric, labels, sample.value, start.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal("failed to track web vital", err)
+		}
+	}
+	k.Flush()
+
+	end := time.Now().Unix()
+	pages, err := k.WebVitalsByLabel(HttpPathLabel, nil, start.Unix(), end)
+	if err != nil || len(pages) != 2 {
+		t.Fatal("expected web vitals of 2 pages, got", pages, err)
+	}
+	if pages[0].Label != "/" || pages[0].Value != 3500 || pages[1].Extra["CLS"] != 0.3 {
+		t.Error("unexpected web vitals by page", pages)
+	}
+
+	dash := Dashboard{}
+	dash.LoadDataForTimeframe(k, Timeframe{Start: start.Unix(), End: end})
+	if len(dash.WebVitals) != len(WebVitals) {
+		t.Fatal("expected all web vitals to be loaded, got", dash.WebVitals)
+	}
+	lcp := dash.WebVitals[0]
+	if lcp.Samples != 5 || lcp.P75 != 3000 || lcp.Rating != WebVitalNeedsImprovement {
+		t.Error("unexpected LCP stats", lcp)
+	}
+	if lcp.GoodPercent != 60 || lcp.NeedsImprovementPercent != 20 || lcp.PoorPercent != 20 {
+		t.Error("unexpected shares of LCP ratings", lcp.GoodPercent, lcp.NeedsImprovementPercent, lcp.PoorPercent)
+	}
+	if len(dash.WebVitalsByPage.Data) != 2 {
+		t.Error("expected web vitals by page to be loaded, got", dash.WebVitalsByPage.Data)
+	}
+
+	dash.LoadDataForTimeframe(k, Timeframe{Start: end + 1, End: end + 3600})
+	if dash.WebVitals != nil {
+		t.Error("expected no web vitals without samples, got", dash.WebVitals)
+	}
+}